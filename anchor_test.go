@@ -0,0 +1,66 @@
+package re2
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMatchAnchored(t *testing.T) {
+	tests := []struct {
+		pattern string
+		input   string
+		anchor  Anchor
+		want    bool
+	}{
+		{pattern: `b+`, input: "abbc", anchor: Unanchored, want: true},
+		{pattern: `b+`, input: "abbc", anchor: AnchorStart, want: false},
+		{pattern: `b+`, input: "bbc", anchor: AnchorStart, want: true},
+		{pattern: `b+`, input: "bbc", anchor: AnchorBoth, want: false},
+		{pattern: `b+`, input: "bbb", anchor: AnchorBoth, want: true},
+		{pattern: `a|ab`, input: "ab", anchor: AnchorBoth, want: true},
+		{pattern: ``, input: "", anchor: AnchorBoth, want: true},
+	}
+
+	for _, tc := range tests {
+		tt := tc
+		t.Run(tt.pattern+"/"+tt.input, func(t *testing.T) {
+			re := MustCompile(tt.pattern)
+			if got := re.MatchAnchored([]byte(tt.input), tt.anchor); got != tt.want {
+				t.Errorf("MatchAnchored(%q, %v) = %v, want %v", tt.input, tt.anchor, got, tt.want)
+			}
+			if got := re.MatchStringAnchored(tt.input, tt.anchor); got != tt.want {
+				t.Errorf("MatchStringAnchored(%q, %v) = %v, want %v", tt.input, tt.anchor, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFindSubmatchIndexAnchored(t *testing.T) {
+	tests := []struct {
+		pattern string
+		input   string
+		anchor  Anchor
+		want    []int
+	}{
+		{pattern: `(a)(b)?`, input: "xab", anchor: Unanchored, want: []int{1, 3, 1, 2, 2, 3}},
+		{pattern: `(a)(b)?`, input: "xab", anchor: AnchorStart, want: nil},
+		{pattern: `(a)(b)?`, input: "abx", anchor: AnchorStart, want: []int{0, 2, 0, 1, 1, 2}},
+		{pattern: `(a)(b)?`, input: "abx", anchor: AnchorBoth, want: nil},
+		{pattern: `(a)(b)?`, input: "a", anchor: AnchorBoth, want: []int{0, 1, 0, 1, -1, -1}},
+		// Leftmost-first would stop at "a", but the anchor forces the longer alternative.
+		{pattern: `(a|ab)`, input: "ab", anchor: AnchorBoth, want: []int{0, 2, 0, 2}},
+	}
+
+	for _, tc := range tests {
+		tt := tc
+		t.Run(tt.pattern+"/"+tt.input, func(t *testing.T) {
+			re := MustCompile(tt.pattern)
+			if got := re.FindSubmatchIndexAnchored([]byte(tt.input), tt.anchor); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("FindSubmatchIndexAnchored(%q, %v) = %v, want %v", tt.input, tt.anchor, got, tt.want)
+			}
+			if got := re.FindStringSubmatchIndexAnchored(tt.input, tt.anchor); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("FindStringSubmatchIndexAnchored(%q, %v) = %v, want %v", tt.input, tt.anchor, got, tt.want)
+			}
+		})
+	}
+}
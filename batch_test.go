@@ -0,0 +1,42 @@
+package re2
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMatchStrings(t *testing.T) {
+	for _, test := range findTests {
+		re := MustCompile(test.pat)
+		inputs := []string{test.text, "", test.text + "x", "x" + test.text}
+		got := re.MatchStrings(inputs)
+		for i, s := range inputs {
+			if want := re.MatchString(s); got[i] != want {
+				t.Errorf("MatchStrings()[%d] = %v, want %v for %q: %s", i, got[i], want, s, test)
+			}
+		}
+	}
+}
+
+func TestFindStringSubmatchIndexBatch(t *testing.T) {
+	for _, test := range findTests {
+		re := MustCompile(test.pat)
+		inputs := []string{test.text, "", test.text + "x", "x" + test.text}
+		got := re.FindStringSubmatchIndexBatch(inputs)
+		for i, s := range inputs {
+			if want := re.FindStringSubmatchIndex(s); !reflect.DeepEqual(got[i], want) {
+				t.Errorf("FindStringSubmatchIndexBatch()[%d] = %v, want %v for %q: %s", i, got[i], want, s, test)
+			}
+		}
+	}
+}
+
+func TestBatchEmpty(t *testing.T) {
+	re := MustCompile(`a`)
+	if got := re.MatchStrings(nil); len(got) != 0 {
+		t.Errorf("MatchStrings(nil) = %v, want empty", got)
+	}
+	if got := re.FindStringSubmatchIndexBatch(nil); len(got) != 0 {
+		t.Errorf("FindStringSubmatchIndexBatch(nil) = %v, want empty", got)
+	}
+}
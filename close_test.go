@@ -0,0 +1,108 @@
+package re2
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestClose(t *testing.T) {
+	re := MustCompile(`a+b`)
+	if !re.MatchString("aab") {
+		t.Fatal("MatchString(aab) = false; want true")
+	}
+
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			re.Close()
+		}()
+	}
+	wg.Wait()
+	re.Close()
+
+	// Methods not using the compiled expression keep working.
+	if got := re.String(); got != `a+b` {
+		t.Errorf("String() = %q; want %q", got, `a+b`)
+	}
+
+	tests := []struct {
+		name string
+		fn   func()
+	}{
+		{name: "MatchString", fn: func() { re.MatchString("aab") }},
+		{name: "FindAllIndex", fn: func() { re.FindAllIndex([]byte("aab"), -1) }},
+		{name: "ReplaceAllString", fn: func() { re.ReplaceAllString("aab", "x") }},
+		{name: "ProgramSize", fn: func() { re.ProgramSize() }},
+		{name: "Longest", fn: func() { re.Longest() }},
+	}
+	for _, tc := range tests {
+		tt := tc
+		t.Run(tt.name, func(t *testing.T) {
+			defer func() {
+				if r := recover(); r != "re2: use of closed Regexp" {
+					t.Errorf("recovered %v; want panic for closed Regexp", r)
+				}
+			}()
+			tt.fn()
+		})
+	}
+}
+
+func TestCloseUnmarshalText(t *testing.T) {
+	var re Regexp
+	if err := re.UnmarshalText([]byte(`a+b`)); err != nil {
+		t.Fatal(err)
+	}
+	re.Close()
+	re.Close()
+
+	func() {
+		defer func() {
+			if r := recover(); r != "re2: use of closed Regexp" {
+				t.Errorf("recovered %v; want panic for closed Regexp", r)
+			}
+		}()
+		re.MatchString("aab")
+	}()
+
+	// Unmarshaling again compiles a new expression.
+	if err := re.UnmarshalText([]byte(`c`)); err != nil {
+		t.Fatal(err)
+	}
+	if !re.MatchString("c") {
+		t.Error("MatchString(c) = false; want true")
+	}
+}
+
+func TestCloseWhileMatching(t *testing.T) {
+	re := MustCompile(`(a+)(b)`)
+	input := strings.Repeat("x", 1<<12) + "aab"
+
+	// Each match either completes with the right result or panics because re
+	// was closed, never using freed memory.
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() {
+				if r := recover(); r != nil && r != "re2: use of closed Regexp" {
+					t.Errorf("recovered %v; want panic for closed Regexp", r)
+				}
+			}()
+			for {
+				if got := re.FindStringSubmatchIndex(input); len(got) != 6 || got[0] != 1<<12 {
+					t.Errorf("FindStringSubmatchIndex() = %v", got)
+					return
+				}
+			}
+		}()
+	}
+	time.Sleep(10 * time.Millisecond)
+	re.Close()
+	wg.Wait()
+}
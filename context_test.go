@@ -0,0 +1,117 @@
+package re2
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMatchContext(t *testing.T) {
+	for _, test := range findTests {
+		re := MustCompile(test.pat)
+		got, err := re.MatchContext(context.Background(), []byte(test.text))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := re.MatchString(test.text); got != want {
+			t.Errorf("MatchContext() = %v, want %v: %s", got, want, test)
+		}
+	}
+}
+
+func TestFindAllIndexContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	for _, test := range findTests {
+		re := MustCompile(test.pat)
+		got, err := re.FindAllIndexContext(ctx, []byte(test.text), -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := re.FindAllIndex([]byte(test.text), -1); !reflect.DeepEqual(got, want) {
+			t.Errorf("FindAllIndexContext() = %v, want %v: %s", got, want, test)
+		}
+	}
+}
+
+func TestContextCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	re := MustCompile(`a`)
+	if _, err := re.MatchContext(ctx, []byte("a")); !errors.Is(err, context.Canceled) {
+		t.Errorf("MatchContext() error = %v, want %v", err, context.Canceled)
+	}
+	if _, err := re.FindAllIndexContext(ctx, []byte("a"), -1); !errors.Is(err, context.Canceled) {
+		t.Errorf("FindAllIndexContext() error = %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestFindAllIndexContextDeadline(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+
+	// Millions of matches take far longer than the deadline to find.
+	b := []byte(strings.Repeat("a", 1<<22))
+	matches, err := MustCompile(`a`).FindAllIndexContext(ctx, b, -1)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("FindAllIndexContext() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if matches != nil {
+		t.Errorf("FindAllIndexContext() returned %d matches, want none", len(matches))
+	}
+}
+
+func TestContextLongInput(t *testing.T) {
+	// Longer than the chunks the input is searched in, with matches crossing
+	// them.
+	as := strings.Repeat("a", 300<<10)
+	inputs := []string{as, as + "b", "c" + as + "bc", as + " c " + as}
+	patterns := []string{`a+b`, `^a`, `^c`, `b$`, `c$`, `a{40}b|c`, `\bc\b`, `(?s).*c`, `c+`, `[0-9]{3}x`}
+
+	for _, pat := range patterns {
+		re := MustCompile(pat)
+		for _, input := range inputs {
+			b := []byte(input)
+			matched, err := re.MatchContext(context.Background(), b)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := re.Match(b); matched != want {
+				t.Errorf("%q: MatchContext() = %v, want %v", pat, matched, want)
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			got, err := re.FindAllIndexContext(ctx, b, -1)
+			cancel()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := re.FindAllIndex(b, -1); !reflect.DeepEqual(got, want) {
+				t.Errorf("%q: FindAllIndexContext() = %d matches, want %d", pat, len(got), len(want))
+			}
+		}
+	}
+}
+
+func TestMatchContextDeadline(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+
+	// The search is stopped between chunks of the input rather than left
+	// running in the background.
+	re := MustCompile(`[0-9]{3}x`)
+	b := []byte(strings.Repeat("a", 1<<26))
+	goroutines := runtime.NumGoroutine()
+	if _, err := re.MatchContext(ctx, b); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("MatchContext() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if n := runtime.NumGoroutine(); n > goroutines {
+		t.Errorf("MatchContext() left %d goroutines running", n-goroutines)
+	}
+}
@@ -0,0 +1,116 @@
+package re2
+
+import (
+	"errors"
+	"regexp/syntax"
+	"testing"
+)
+
+func TestCompileError(t *testing.T) {
+	tests := []struct {
+		pattern string
+		code    syntax.ErrorCode
+		expr    string
+		offset  int
+	}{
+		{pattern: `ab\x`, code: syntax.ErrInvalidEscape, expr: `\x`, offset: 2},
+		{pattern: `a[z-a]`, code: syntax.ErrInvalidCharRange, expr: `z-a`, offset: 2},
+		{pattern: `a(b`, code: syntax.ErrMissingParen, expr: `a(b`, offset: 0},
+		{pattern: `ab)`, code: syntax.ErrUnexpectedParen, expr: `ab)`, offset: 0},
+		{pattern: `x[a-z`, code: syntax.ErrMissingBracket, expr: `[a-z`, offset: 1},
+		{pattern: `a**`, code: syntax.ErrInvalidRepeatOp, expr: `**`, offset: 1},
+		{pattern: `*`, code: syntax.ErrMissingRepeatArgument, expr: `*`, offset: 0},
+		{pattern: `a{1001}`, code: syntax.ErrInvalidRepeatSize, expr: `{1001}`, offset: 1},
+		{pattern: `a(?P<n!>b)`, code: syntax.ErrInvalidNamedCapture, expr: `(?P<n!>`, offset: 1},
+		// The fragment also occurs before the error.
+		{pattern: `\x41\x`, code: syntax.ErrInvalidEscape, expr: `\x`, offset: 4},
+		{pattern: `[a][`, code: syntax.ErrMissingBracket, expr: `[`, offset: 3},
+		{pattern: `(\x41\x)`, code: syntax.ErrInvalidEscape, expr: `\x)`, offset: 5},
+		{pattern: `a*b*c**`, code: syntax.ErrInvalidRepeatOp, expr: `**`, offset: 5},
+		{pattern: `\x\x41`, code: syntax.ErrInvalidEscape, expr: `\x\x`, offset: 0},
+	}
+
+	for _, tc := range tests {
+		tt := tc
+		t.Run(tt.pattern, func(t *testing.T) {
+			_, err := Compile(tt.pattern)
+			if err == nil {
+				t.Fatal("expected error")
+			}
+
+			var reErr *Error
+			if !errors.As(err, &reErr) {
+				t.Fatalf("expected *Error, got %T", err)
+			}
+			if reErr.Code != tt.code {
+				t.Errorf("Code = %q, want %q", reErr.Code, tt.code)
+			}
+			if reErr.Expr != tt.expr {
+				t.Errorf("Expr = %q, want %q", reErr.Expr, tt.expr)
+			}
+			if reErr.Offset != tt.offset {
+				t.Errorf("Offset = %d, want %d", reErr.Offset, tt.offset)
+			}
+
+			var synErr *syntax.Error
+			if !errors.As(err, &synErr) {
+				t.Fatalf("expected to unwrap to *syntax.Error")
+			}
+			if synErr.Code != tt.code || synErr.Expr != tt.expr {
+				t.Errorf("syntax.Error = %v, want code %q and expr %q", synErr, tt.code, tt.expr)
+			}
+		})
+	}
+}
+
+func TestMaxProgramSize(t *testing.T) {
+	small := MustCompile(`abc`)
+	large := MustCompile(`[a-z]{50}`)
+	if small.ProgramSize() < 0 {
+		// The library was built without the program size, so any limit fails.
+		for _, expr := range []string{`abc`, `[a-z]{50}`} {
+			_, err := CompileWithOptions(expr, Options{MaxProgramSize: 1000})
+			var sizeErr *ProgramSizeError
+			if !errors.As(err, &sizeErr) || sizeErr.Size != -1 || !errors.Is(err, errors.ErrUnsupported) {
+				t.Errorf("expected *ProgramSizeError with unknown size for %q, got %v", expr, err)
+			}
+		}
+		return
+	}
+
+	if small.ProgramSize() >= large.ProgramSize() {
+		t.Fatalf("ProgramSize() = %d for small expression, want less than %d", small.ProgramSize(), large.ProgramSize())
+	}
+	if large.ReverseProgramSize() <= 0 {
+		t.Errorf("ReverseProgramSize() = %d, want positive", large.ReverseProgramSize())
+	}
+
+	limit := small.ProgramSize()
+	if _, err := CompileWithOptions(`abc`, Options{MaxProgramSize: limit}); err != nil {
+		t.Errorf("expected program at limit to compile, got %v", err)
+	}
+
+	_, err := CompileWithOptions(`[a-z]{50}`, Options{MaxProgramSize: limit})
+	var sizeErr *ProgramSizeError
+	if !errors.As(err, &sizeErr) {
+		t.Fatalf("expected *ProgramSizeError, got %v", err)
+	}
+	if sizeErr.Size != large.ProgramSize() || sizeErr.Max != limit {
+		t.Errorf("got Size = %d, Max = %d, want %d, %d", sizeErr.Size, sizeErr.Max, large.ProgramSize(), limit)
+	}
+	var synErr *syntax.Error
+	if !errors.As(err, &synErr) || synErr.Code != syntax.ErrLarge {
+		t.Errorf("expected *syntax.Error with code %q, got %v", syntax.ErrLarge, err)
+	}
+}
+
+func TestMaxMem(t *testing.T) {
+	if _, err := CompileWithOptions(`[a-z]{500}`, Options{MaxMem: 1 << 10}); err == nil {
+		t.Fatal("expected error compiling with small MaxMem")
+	} else {
+		var reErr *Error
+		if !errors.As(err, &reErr) || reErr.Code != syntax.ErrLarge {
+			t.Errorf("expected *Error with code %q, got %v", syntax.ErrLarge, err)
+		}
+	}
+}
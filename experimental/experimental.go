@@ -26,7 +26,80 @@ func MustCompileLatin1(str string) *re2.Regexp {
 // Set is a compiled collection of regular expressions that can be searched for simultaneously.
 type Set = internal.Set
 
+// SetError is returned when compiling a Set with an invalid expression,
+// reporting which of the expressions was invalid.
+type SetError = internal.SetError
+
+// ErrSetOutOfMemory is returned by Set.FindAllE when RE2 ran out of memory
+// matching the Set, in which case it is unknown whether any pattern matched.
+var ErrSetOutOfMemory = internal.ErrSetOutOfMemory
+
+// SetMatch is the location of a match of a single pattern in a Set, as
+// returned by Set.FindAllIndex and related methods and by Replacer.
+type SetMatch = internal.SetMatch
+
 // CompileSet compiles the set of regular expression in preparation for matching.
 func CompileSet(exprs []string) (*Set, error) {
-	return internal.CompileSet(exprs, internal.CompileOptions{}) //nolint:wrapcheck // just a method forwarder
+	return internal.CompileSet(exprs, internal.CompileOptions{}, internal.Unanchored) //nolint:wrapcheck // just a method forwarder
+}
+
+// CompileSetCaseInsensitive is like CompileSet but all the expressions match
+// without regard to case.
+func CompileSetCaseInsensitive(exprs []string) (*Set, error) {
+	return internal.CompileSet(exprs, internal.CompileOptions{CaseInsensitive: true}, internal.Unanchored) //nolint:wrapcheck // just a method forwarder
+}
+
+// CompileSetLatin1 is like CompileSet but causes the matching to treat
+// the input as arbitrary bytes rather than unicode strings, as with
+// CompileLatin1.
+func CompileSetLatin1(exprs []string) (*Set, error) {
+	return internal.CompileSet(exprs, internal.CompileOptions{Latin1: true}, internal.Unanchored) //nolint:wrapcheck // just a method forwarder
+}
+
+// CompileSetWithOptions is like CompileSet but compiles all the expressions
+// with opts, as with re2.CompileWithOptions.
+func CompileSetWithOptions(exprs []string, opts re2.Options) (*Set, error) {
+	return internal.CompileSet(exprs, opts, internal.Unanchored) //nolint:wrapcheck // just a method forwarder
+}
+
+// CompileSetAnchored is like CompileSet but every expression in the Set is
+// anchored with anchor. With re2.AnchorBoth, a pattern only matches if it
+// spans the entire input, as if it were wrapped in ^...$.
+func CompileSetAnchored(exprs []string, anchor re2.Anchor) (*Set, error) {
+	return internal.CompileSet(exprs, internal.CompileOptions{}, anchor) //nolint:wrapcheck // just a method forwarder
+}
+
+// SetScanMatch is a match of a pattern of a Set reported by a SetScanner.
+type SetScanMatch = internal.SetScanMatch
+
+// SetScanner scans a stream with a Set as it is written, in chunks, carrying
+// over a configurable overlap between chunks so matches straddling them are
+// not lost. It implements io.Writer and io.ReaderFrom, so it can be used with
+// io.Copy.
+type SetScanner = internal.SetScanner
+
+// NewSetScanner returns a SetScanner searching with set, carrying overlap
+// bytes between chunks and calling report for each match found.
+func NewSetScanner(set *Set, overlap int, report func(SetScanMatch)) *SetScanner {
+	return internal.NewSetScanner(set, overlap, report)
+}
+
+// Replacer replaces the matches of all the patterns of a Set in a single
+// left-to-right pass over the input, replacing the leftmost match where
+// matches overlap and preferring the lowest pattern index among matches
+// starting at the same position.
+type Replacer = internal.Replacer
+
+// NewReplacer returns a Replacer replacing the matches of each pattern of set
+// with the template at the same index of templates, interpreted as in
+// re2.Regexp.Expand.
+func NewReplacer(set *Set, templates []string) (*Replacer, error) {
+	return internal.NewReplacer(set, templates) //nolint:wrapcheck // just a method forwarder
+}
+
+// NewReplacerFunc returns a Replacer replacing the matches of set with the
+// return value of repl applied to the index of the matched pattern and the
+// matched text.
+func NewReplacerFunc(set *Set, repl func(pattern int, match string) string) (*Replacer, error) {
+	return internal.NewReplacerFunc(set, repl) //nolint:wrapcheck // just a method forwarder
 }
@@ -1,11 +1,17 @@
 package experimental
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"reflect"
+	"regexp/syntax"
+	"slices"
 	"sort"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/wasilibs/go-re2"
 )
@@ -61,6 +67,21 @@ func TestCompileLatin1(t *testing.T) {
 	}
 }
 
+func TestLatin1ReplaceAll(t *testing.T) {
+	// Empty matches advance a UTF-8 rune at a time as with other expressions,
+	// whichever path does the replacement.
+	re := MustCompileLatin1(`x*`)
+	if got, want := re.ReplaceAllString("☺x☺", "-"), "-☺-☺-"; got != want {
+		t.Errorf("ReplaceAllString() = %q, want %q", got, want)
+	}
+	if got, want := re.ReplaceAllLiteralString("☺x☺", "-"), "-☺-☺-"; got != want {
+		t.Errorf("ReplaceAllLiteralString() = %q, want %q", got, want)
+	}
+	if got, want := string(re.ReplaceAll([]byte("☺x☺"), []byte("[$0]"))), "[]☺[x]☺[]"; got != want {
+		t.Errorf("ReplaceAll() = %q, want %q", got, want)
+	}
+}
+
 var goodRe = []string{
 	``,
 	`.`,
@@ -125,6 +146,29 @@ func TestBadCompileSet(t *testing.T) {
 	}
 }
 
+func TestCompileSetError(t *testing.T) {
+	_, err := CompileSet([]string{`abc`, `\d+`, `x[a-z`, `(`})
+	if err == nil {
+		t.Fatal("expected error")
+	}
+
+	var setErr *SetError
+	if !errors.As(err, &setErr) {
+		t.Fatalf("expected *SetError, got %T", err)
+	}
+	if setErr.Index != 2 {
+		t.Errorf("Index = %d, want 2", setErr.Index)
+	}
+
+	var reErr *re2.Error
+	if !errors.As(err, &reErr) {
+		t.Fatalf("expected *re2.Error, got %T", setErr.Err)
+	}
+	if reErr.Code != syntax.ErrMissingBracket || reErr.Expr != "[a-z" || reErr.Offset != 1 {
+		t.Errorf("Error = {%q, %q, %d}, want {%q, %q, %d}", reErr.Code, reErr.Expr, reErr.Offset, syntax.ErrMissingBracket, "[a-z", 1)
+	}
+}
+
 type SetTest struct {
 	exprs   []string
 	matches string
@@ -215,6 +259,243 @@ func TestSetFindAllString(t *testing.T) {
 	}
 }
 
+func TestCompileSetCaseInsensitive(t *testing.T) {
+	set, err := CompileSetCaseInsensitive([]string{`abc`, `a(?-i:b)c`, `\d+`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	setFindAllStringTest(t, set, "ABC", -1, []int{0})
+	setFindAllStringTest(t, set, "AbC", -1, []int{0, 1})
+	setFindAllStringTest(t, set, "xyz", -1, nil)
+}
+
+func TestCompileSetLatin1(t *testing.T) {
+	set, err := CompileSetLatin1([]string{`\xac\xed\x00\x05`, `\xff+`, "ハロー"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	setFindAllTest(t, set, "\xac\xed\x00\x05t\x00\x04test", -1, []int{0})
+	setFindAllTest(t, set, "\x00\xff\xff", -1, []int{1})
+	setFindAllTest(t, set, "ハローワールド", -1, []int{2})
+}
+
+func TestCompileSetWithOptions(t *testing.T) {
+	tests := []struct {
+		name  string
+		exprs []string
+		opts  re2.Options
+		input string
+		want  []int
+	}{
+		{name: "default", exprs: []string{`a.c`, `x`}, input: "a\nc", want: nil},
+		{name: "dot nl", exprs: []string{`a.c`, `x`}, opts: re2.Options{DotNL: true}, input: "a\nc", want: []int{0}},
+		{name: "literal", exprs: []string{`a.c`, `(x`}, opts: re2.Options{Literal: true}, input: "abc(x", want: []int{1}},
+		{name: "case insensitive", exprs: []string{`abc`, `x`}, opts: re2.Options{CaseInsensitive: true}, input: "ABC", want: []int{0}},
+		{name: "posix", exprs: []string{`a+`, `b`}, opts: re2.Options{Posix: true, Longest: true}, input: "aab", want: []int{0, 1}},
+	}
+
+	for _, tc := range tests {
+		tt := tc
+		t.Run(tt.name, func(t *testing.T) {
+			set, err := CompileSetWithOptions(tt.exprs, tt.opts)
+			if errors.Is(err, errors.ErrUnsupported) {
+				t.Skip(err)
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			setFindAllStringTest(t, set, tt.input, -1, tt.want)
+		})
+	}
+}
+
+func TestCompileSetAnchored(t *testing.T) {
+	exprs := []string{`/users`, `/users/[0-9]+`, `[a-z]+`}
+	tests := []struct {
+		name   string
+		anchor re2.Anchor
+		input  string
+		want   []int
+	}{
+		{name: "unanchored", anchor: re2.Unanchored, input: "/api/users/10", want: []int{0, 1, 2}},
+		{name: "start", anchor: re2.AnchorStart, input: "/api/users/10", want: nil},
+		{name: "start prefix", anchor: re2.AnchorStart, input: "/users/10/posts", want: []int{0, 1}},
+		{name: "both", anchor: re2.AnchorBoth, input: "/users/10/posts", want: nil},
+		{name: "both full", anchor: re2.AnchorBoth, input: "/users/10", want: []int{1}},
+		{name: "both word", anchor: re2.AnchorBoth, input: "users", want: []int{2}},
+	}
+
+	for _, tc := range tests {
+		tt := tc
+		t.Run(tt.name, func(t *testing.T) {
+			set, err := CompileSetAnchored(exprs, tt.anchor)
+			if err != nil {
+				t.Fatal(err)
+			}
+			setFindAllStringTest(t, set, tt.input, -1, tt.want)
+		})
+	}
+}
+
+func TestSetFindAllIndex(t *testing.T) {
+	set, err := CompileSet([]string{`(\d+)-(\d+)`, `[a-z]+`, `x(y)?`, `nomatch`})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	input := "abc 12-34 x"
+	wantIndex := []SetMatch{
+		{Pattern: 0, Index: []int{4, 9}},
+		{Pattern: 1, Index: []int{0, 3}},
+		{Pattern: 2, Index: []int{10, 11}},
+	}
+	wantSubmatchIndex := []SetMatch{
+		{Pattern: 0, Index: []int{4, 9, 4, 6, 7, 9}},
+		{Pattern: 1, Index: []int{0, 3}},
+		{Pattern: 2, Index: []int{10, 11, -1, -1}},
+	}
+
+	if got := set.FindAllIndex([]byte(input), -1); !reflect.DeepEqual(got, wantIndex) {
+		t.Errorf("FindAllIndex(%q) = %v, want %v", input, got, wantIndex)
+	}
+	if got := set.FindAllStringIndex(input, -1); !reflect.DeepEqual(got, wantIndex) {
+		t.Errorf("FindAllStringIndex(%q) = %v, want %v", input, got, wantIndex)
+	}
+	if got := set.FindAllSubmatchIndex([]byte(input), -1); !reflect.DeepEqual(got, wantSubmatchIndex) {
+		t.Errorf("FindAllSubmatchIndex(%q) = %v, want %v", input, got, wantSubmatchIndex)
+	}
+	if got := set.FindAllStringSubmatchIndex(input, -1); !reflect.DeepEqual(got, wantSubmatchIndex) {
+		t.Errorf("FindAllStringSubmatchIndex(%q) = %v, want %v", input, got, wantSubmatchIndex)
+	}
+	if got := set.FindAllStringIndex(input, 1); len(got) != 1 {
+		t.Errorf("FindAllStringIndex(%q, 1) = %v, want 1 match", input, got)
+	}
+	if got := set.FindAllStringIndex("???", -1); got != nil {
+		t.Errorf("FindAllStringIndex(%q) = %v, want nil", "???", got)
+	}
+}
+
+func TestSetFindAllIndexAnchored(t *testing.T) {
+	set, err := CompileSetAnchored([]string{`/users/(\d+)`, `/users`}, re2.AnchorStart)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Unanchored, /users would match at offset 4 first.
+	input := "/users/10/api/users"
+	want := []SetMatch{
+		{Pattern: 0, Index: []int{0, 9, 7, 9}},
+		{Pattern: 1, Index: []int{0, 6}},
+	}
+	if got := set.FindAllStringSubmatchIndex(input, -1); !reflect.DeepEqual(got, want) {
+		t.Errorf("FindAllStringSubmatchIndex(%q) = %v, want %v", input, got, want)
+	}
+}
+
+func TestSetMatch(t *testing.T) {
+	set, err := CompileSet([]string{`abc`, `\d+`, `x$`})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		input string
+		want  []int
+	}{
+		{input: "abc", want: []int{0}},
+		{input: "abc123x", want: []int{0, 1, 2}},
+		{input: "xy", want: nil},
+		{input: "", want: nil},
+	}
+
+	for _, tc := range tests {
+		tt := tc
+		t.Run(tt.input, func(t *testing.T) {
+			if got := set.Match([]byte(tt.input)); got != (tt.want != nil) {
+				t.Errorf("Match(%q) = %v, want %v", tt.input, got, tt.want != nil)
+			}
+			if got := set.MatchString(tt.input); got != (tt.want != nil) {
+				t.Errorf("MatchString(%q) = %v, want %v", tt.input, got, tt.want != nil)
+			}
+
+			dst := []int{-1}
+			got := set.AppendMatches(dst, []byte(tt.input))
+			sort.Ints(got[1:])
+			if want := append([]int{-1}, tt.want...); !reflect.DeepEqual(got, want) {
+				t.Errorf("AppendMatches(%q) = %v, want %v", tt.input, got, want)
+			}
+			got = set.AppendMatchesString(dst[:0], tt.input)
+			sort.Ints(got)
+			if len(got) != len(tt.want) || (len(got) > 0 && !reflect.DeepEqual(got, tt.want)) {
+				t.Errorf("AppendMatchesString(%q) = %v, want %v", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetAppendMatchesAllocs(t *testing.T) {
+	set, err := CompileSet(goodRe)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	input := []byte("abcd123")
+	dst := make([]int, 0, len(goodRe))
+	allocs := testing.AllocsPerRun(100, func() {
+		dst = set.AppendMatches(dst[:0], input)
+	})
+	// Some backends allocate when calling into the module, so only require
+	// no allocation beyond what Match needs.
+	matchAllocs := testing.AllocsPerRun(100, func() {
+		set.Match(input)
+	})
+	if allocs > matchAllocs {
+		t.Errorf("AppendMatches allocated %v times, want at most %v", allocs, matchAllocs)
+	}
+}
+
+func TestSetFindAllE(t *testing.T) {
+	set, err := CompileSet(goodRe)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, input := range []string{"abcd123", "x", ""} {
+		want := set.FindAllString(input, -1)
+
+		got, err := set.FindAllE([]byte(input), -1)
+		if err != nil {
+			t.Errorf("FindAllE(%q) error: %v", input, err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("FindAllE(%q) = %v, want %v", input, got, want)
+		}
+
+		got, err = set.FindAllStringE(input, -1)
+		if err != nil {
+			t.Errorf("FindAllStringE(%q) error: %v", input, err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("FindAllStringE(%q) = %v, want %v", input, got, want)
+		}
+	}
+}
+
+func TestCompileSetOutOfMemory(t *testing.T) {
+	exprs := make([]string, 20)
+	for i := range exprs {
+		exprs[i] = fmt.Sprintf(`[a-q][^u-z]{13}x%d`, i)
+	}
+	// Too small for the program and the DFA RE2 needs to match the set.
+	set, err := CompileSetWithOptions(exprs, re2.Options{MaxMem: 4 << 10})
+	if err == nil {
+		t.Fatal("expected error compiling set")
+	}
+	if set != nil {
+		t.Errorf("expected nil set, got %v", set)
+	}
+}
+
 func BenchmarkSet(b *testing.B) {
 	b.Run("findAll", func(b *testing.B) {
 		set, err := CompileSet(goodRe)
@@ -246,6 +527,24 @@ func BenchmarkSetMatchWithFindSubmatch(b *testing.B) {
 			re.FindAllStringSubmatchIndex("abcd123", 20)
 		}
 	})
+	b.Run("set match only", func(b *testing.B) {
+		set, err := CompileSet(goodRe)
+		if err != nil {
+			panic(err)
+		}
+		for range b.N {
+			set.Match([]byte("abcd123"))
+		}
+	})
+	b.Run("set submatch", func(b *testing.B) {
+		set, err := CompileSet(goodRe)
+		if err != nil {
+			panic(err)
+		}
+		for range b.N {
+			set.FindAllStringSubmatchIndex("abcd123", 20)
+		}
+	})
 }
 
 func ExampleCompileSet() {
@@ -264,3 +563,556 @@ func ExampleCompileSet() {
 	// [0 1]
 	// []
 }
+
+func TestSetScanner(t *testing.T) {
+	set, err := CompileSet([]string{`attack`, `evil\d+`, `x`})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		chunks []string
+		want   []SetScanMatch
+	}{
+		{
+			name:   "within chunk",
+			chunks: []string{"---attack---", "------------"},
+			want:   []SetScanMatch{{Pattern: 0, Offset: 0}},
+		},
+		{
+			name:   "straddling chunks",
+			chunks: []string{"----------att", "ack---------"},
+			want:   []SetScanMatch{{Pattern: 0, Offset: 5}},
+		},
+		{
+			name:   "in overlap not repeated",
+			chunks: []string{"--------attack", "-", "-"},
+			want:   []SetScanMatch{{Pattern: 0, Offset: 0}},
+		},
+		{
+			name:   "repeated after overlap",
+			chunks: []string{"attack------", "--attack"},
+			want:   []SetScanMatch{{Pattern: 0, Offset: 0}, {Pattern: 0, Offset: 4}},
+		},
+		{
+			name:   "repeated within overlap",
+			chunks: []string{"------evil1", "2"},
+			want:   []SetScanMatch{{Pattern: 1, Offset: 0}, {Pattern: 1, Offset: 3}},
+		},
+		{
+			name:   "small chunks",
+			chunks: []string{"att", "a", "c", "k"},
+			want:   []SetScanMatch{{Pattern: 0, Offset: 0}},
+		},
+		{
+			name:   "multiple patterns",
+			chunks: []string{"--evil", "9x--"},
+			want:   []SetScanMatch{{Pattern: 1, Offset: 0}, {Pattern: 2, Offset: 0}},
+		},
+	}
+
+	for _, tc := range tests {
+		tt := tc
+		t.Run(tt.name, func(t *testing.T) {
+			var got []SetScanMatch
+			s := NewSetScanner(set, 8, func(m SetScanMatch) {
+				got = append(got, m)
+			})
+			n := 0
+			for _, c := range tt.chunks {
+				if _, err := s.Write([]byte(c)); err != nil {
+					t.Fatal(err)
+				}
+				n += len(c)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+			if s.Offset() != int64(n) {
+				t.Errorf("Offset() = %d, want %d", s.Offset(), n)
+			}
+		})
+	}
+}
+
+func TestSetScannerAnchored(t *testing.T) {
+	tests := []struct {
+		name   string
+		anchor re2.Anchor
+		chunks []string
+		want   []SetScanMatch
+	}{
+		{
+			name:   "at start",
+			anchor: re2.AnchorStart,
+			chunks: []string{"att", "ack---", "attack"},
+			want:   []SetScanMatch{{Pattern: 0, Offset: 0}},
+		},
+		{
+			name:   "mid-stream across chunks",
+			anchor: re2.AnchorStart,
+			chunks: []string{"------atta", "ck"},
+			want:   nil,
+		},
+		{
+			name:   "both",
+			anchor: re2.AnchorBoth,
+			chunks: []string{"att", "ack"},
+			want:   []SetScanMatch{{Pattern: 0, Offset: 0}},
+		},
+		{
+			name:   "both mid-stream across chunks",
+			anchor: re2.AnchorBoth,
+			chunks: []string{"------atta", "ck"},
+			want:   nil,
+		},
+	}
+
+	for _, tc := range tests {
+		tt := tc
+		t.Run(tt.name, func(t *testing.T) {
+			set, err := CompileSetAnchored([]string{`attack`, `x`}, tt.anchor)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []SetScanMatch
+			// The window after "------atta" begins mid-stream at "attack".
+			s := NewSetScanner(set, 4, func(m SetScanMatch) {
+				got = append(got, m)
+			})
+			for _, c := range tt.chunks {
+				if _, err := s.Write([]byte(c)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetScannerReadFrom(t *testing.T) {
+	set, err := CompileSet([]string{`needle`, `haystack`})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []int
+	s := NewSetScanner(set, 16, func(m SetScanMatch) {
+		got = append(got, m.Pattern)
+	})
+	// Place the needle across the chunks read by ReadFrom.
+	input := strings.Repeat("-", 32<<10-3) + "needle" + strings.Repeat("-", 100)
+	n, err := s.ReadFrom(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(len(input)) {
+		t.Errorf("read %d bytes, want %d", n, len(input))
+	}
+	if want := []int{0}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestSetAll(t *testing.T) {
+	set, err := CompileSet([]string{`foo`, `bar`, `baz`})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := slices.Sorted(set.All([]byte("foo baz")))
+	if want := []int{0, 2}; !reflect.DeepEqual(got, want) {
+		t.Errorf("All() = %v, want %v", got, want)
+	}
+	got = slices.Sorted(set.AllString("bar"))
+	if want := []int{1}; !reflect.DeepEqual(got, want) {
+		t.Errorf("AllString() = %v, want %v", got, want)
+	}
+
+	n := 0
+	for range set.AllString("foo bar baz") {
+		n++
+		break
+	}
+	if n != 1 {
+		t.Errorf("iterated %d times after break, want 1", n)
+	}
+}
+
+func TestSetInput(t *testing.T) {
+	set, err := CompileSet([]string{`foo`, `bar`, `baz`})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	in := re2.NewInputString("foo baz")
+	defer in.Release()
+
+	if !set.MatchInput(in) {
+		t.Error("MatchInput() = false, want true")
+	}
+	got := set.FindAllInput(in, -1)
+	sort.Ints(got)
+	if want := []int{0, 2}; !reflect.DeepEqual(got, want) {
+		t.Errorf("FindAllInput() = %v, want %v", got, want)
+	}
+	if got := set.FindAllInput(in, 1); len(got) != 1 {
+		t.Errorf("FindAllInput(1) = %v, want 1 match", got)
+	}
+
+	other := re2.NewInput([]byte("qux"))
+	defer other.Release()
+	if set.MatchInput(other) {
+		t.Error("MatchInput() = true, want false")
+	}
+}
+
+func TestSetFindAllBatch(t *testing.T) {
+	set, err := CompileSet([]string{`foo`, `bar`, `baz`})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	inputs := [][]byte{[]byte("foo baz"), nil, []byte("qux"), []byte("bar")}
+	got := set.FindAllBatch(inputs, -1)
+	if len(got) != len(inputs) {
+		t.Fatalf("FindAllBatch() returned %d results, want %d", len(got), len(inputs))
+	}
+	for i, b := range inputs {
+		sort.Ints(got[i])
+		want := set.FindAll(b, -1)
+		sort.Ints(want)
+		if !reflect.DeepEqual(got[i], want) {
+			t.Errorf("FindAllBatch()[%d] = %v, want %v", i, got[i], want)
+		}
+	}
+
+	for i, matches := range set.FindAllBatch(inputs, 1) {
+		if want := min(1, len(set.FindAll(inputs[i], -1))); len(matches) != want {
+			t.Errorf("FindAllBatch(1)[%d] = %v, want %d matches", i, matches, want)
+		}
+	}
+}
+
+func TestSetFindAllContext(t *testing.T) {
+	set, err := CompileSet([]string{`foo`, `bar`, `baz`})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	got, err := set.FindAllContext(ctx, []byte("foo baz"), -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Ints(got)
+	if want := []int{0, 2}; !reflect.DeepEqual(got, want) {
+		t.Errorf("FindAllContext() = %v, want %v", got, want)
+	}
+
+	// Longer than the chunks the input is searched in, with matches
+	// straddling them.
+	exprs := []string{
+		`foo`, `bar`, `foo.*bar`, `(?s).*x+ bar`, `baz`, `needle`, `x{1000}y`,
+		`^foo`, `bar$`, `\bneedle\b`, `^x`, `x$`, `\Bneedle`,
+	}
+	longs := [][]byte{
+		[]byte("foo " + strings.Repeat("x", 300<<10) + " bar"),
+		[]byte(strings.Repeat("x", 64<<10-3) + "needle" + strings.Repeat("x", 100<<10) + "y"),
+		[]byte(strings.Repeat("y", 128<<10-2) + " needle " + strings.Repeat("y", 10)),
+	}
+	for _, long := range longs {
+		for _, anchor := range []re2.Anchor{re2.Unanchored, re2.AnchorStart, re2.AnchorBoth} {
+			set, err := CompileSetAnchored(exprs, anchor)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := set.FindAllContext(ctx, long, -1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := set.FindAll(long, -1)
+			sort.Ints(want)
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("anchor %v: FindAllContext() = %v, want %v", anchor, got, want)
+			}
+			if len(want) > 1 {
+				got, err := set.FindAllContext(ctx, long, 1)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !reflect.DeepEqual(got, want[:1]) {
+					t.Errorf("anchor %v: FindAllContext(1) = %v, want %v", anchor, got, want[:1])
+				}
+			}
+		}
+	}
+
+	cancel()
+	if _, err := set.FindAllContext(ctx, []byte("foo"), -1); !errors.Is(err, context.Canceled) {
+		t.Errorf("FindAllContext() error = %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestReplacer(t *testing.T) {
+	tests := []struct {
+		name      string
+		exprs     []string
+		templates []string
+		input     string
+		want      string
+		wantSpans []SetMatch
+	}{
+		{
+			name:      "no match",
+			exprs:     []string{`\d{3}-\d{4}`, `\w+@\w+\.com`},
+			templates: []string{`<phone>`, `<email>`},
+			input:     "nothing here",
+			want:      "nothing here",
+		},
+		{
+			name:      "several patterns",
+			exprs:     []string{`\d{3}-\d{4}`, `\w+@\w+\.com`},
+			templates: []string{`<phone>`, `<email>`},
+			input:     "call 555-1234 or mail bob@example.com or 555-9876",
+			want:      "call <phone> or mail <email> or <phone>",
+			wantSpans: []SetMatch{
+				{Pattern: 0, Index: []int{5, 13}},
+				{Pattern: 1, Index: []int{22, 37}},
+				{Pattern: 0, Index: []int{41, 49}},
+			},
+		},
+		{
+			name:      "leftmost wins",
+			exprs:     []string{`cd`, `bcd`},
+			templates: []string{`1`, `2`},
+			input:     "abcde",
+			want:      "a2e",
+			wantSpans: []SetMatch{{Pattern: 1, Index: []int{1, 4}}},
+		},
+		{
+			name:      "lowest index wins at same start",
+			exprs:     []string{`ab`, `abc`},
+			templates: []string{`1`, `2`},
+			input:     "abcabc",
+			want:      "1c1c",
+			wantSpans: []SetMatch{{Pattern: 0, Index: []int{0, 2}}, {Pattern: 0, Index: []int{3, 5}}},
+		},
+		{
+			name:      "overlapped match searched again",
+			exprs:     []string{`aa`, `ab`},
+			templates: []string{`1`, `2`},
+			input:     "aab",
+			want:      "1b",
+			wantSpans: []SetMatch{{Pattern: 0, Index: []int{0, 2}}},
+		},
+		{
+			name:      "templates",
+			exprs:     []string{`(\w+)@(\w+)\.com`, `(?P<area>\d{3})-\d{4}`},
+			templates: []string{`$1 at $2`, `${area}-xxxx`},
+			input:     "bob@example.com, 555-1234",
+			want:      "bob at example, 555-xxxx",
+			wantSpans: []SetMatch{{Pattern: 0, Index: []int{0, 15}}, {Pattern: 1, Index: []int{17, 25}}},
+		},
+		{
+			name:      "empty matches",
+			exprs:     []string{`x*`, `b`},
+			templates: []string{`-`, `B`},
+			input:     "abxc",
+			// The empty match at 1 is preferred to b, which it skips over.
+			want: "-a-b-c-",
+			wantSpans: []SetMatch{
+				{Pattern: 0, Index: []int{0, 0}},
+				{Pattern: 0, Index: []int{1, 1}},
+				{Pattern: 0, Index: []int{2, 3}},
+				{Pattern: 0, Index: []int{4, 4}},
+			},
+		},
+		{
+			name:      "lower index preferred to empty match",
+			exprs:     []string{`b`, `x*`},
+			templates: []string{`B`, `-`},
+			input:     "abxc",
+			want:      "-aB-c-",
+			wantSpans: []SetMatch{
+				{Pattern: 1, Index: []int{0, 0}},
+				{Pattern: 0, Index: []int{1, 2}},
+				{Pattern: 1, Index: []int{2, 3}},
+				{Pattern: 1, Index: []int{4, 4}},
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		tt := tc
+		t.Run(tt.name, func(t *testing.T) {
+			set, err := CompileSet(tt.exprs)
+			if err != nil {
+				t.Fatal(err)
+			}
+			r, err := NewReplacer(set, tt.templates)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, spans := r.ReplaceString(tt.input)
+			if got != tt.want {
+				t.Errorf("ReplaceString(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+			if !reflect.DeepEqual(spans, tt.wantSpans) {
+				t.Errorf("ReplaceString(%q) spans = %v, want %v", tt.input, spans, tt.wantSpans)
+			}
+
+			gotb, spans := r.Replace([]byte(tt.input))
+			if string(gotb) != tt.want {
+				t.Errorf("Replace(%q) = %q, want %q", tt.input, gotb, tt.want)
+			}
+			if !reflect.DeepEqual(spans, tt.wantSpans) {
+				t.Errorf("Replace(%q) spans = %v, want %v", tt.input, spans, tt.wantSpans)
+			}
+		})
+	}
+}
+
+func TestReplacerFunc(t *testing.T) {
+	set, err := CompileSet([]string{`\d+`, `[a-z]+`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := NewReplacerFunc(set, func(pattern int, match string) string {
+		if pattern == 0 {
+			return strings.Repeat("#", len(match))
+		}
+		return strings.ToUpper(match)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, spans := r.ReplaceString("abc 123 de4")
+	if want := "ABC ### DE#"; got != want {
+		t.Errorf("ReplaceString = %q, want %q", got, want)
+	}
+	wantSpans := []SetMatch{
+		{Pattern: 1, Index: []int{0, 3}},
+		{Pattern: 0, Index: []int{4, 7}},
+		{Pattern: 1, Index: []int{8, 10}},
+		{Pattern: 0, Index: []int{10, 11}},
+	}
+	if !reflect.DeepEqual(spans, wantSpans) {
+		t.Errorf("ReplaceString spans = %v, want %v", spans, wantSpans)
+	}
+}
+
+func TestReplacerAnchored(t *testing.T) {
+	set, err := CompileSetAnchored([]string{`a`, `b`}, re2.AnchorStart)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := NewReplacer(set, []string{`1`, `2`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := r.ReplaceString("aab"); got != "1ab" {
+		t.Errorf("ReplaceString = %q, want %q", got, "1ab")
+	}
+}
+
+func TestNewReplacerMismatch(t *testing.T) {
+	set, err := CompileSet([]string{`a`, `b`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewReplacer(set, []string{`1`}); err == nil {
+		t.Error("NewReplacer with too few templates succeeded")
+	}
+}
+
+func TestSetClose(t *testing.T) {
+	set, err := CompileSet([]string{`a`, `b`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Locating matches compiles the patterns, which are closed with the Set.
+	if got := set.FindAllIndex([]byte("ab"), -1); len(got) != 2 {
+		t.Fatalf("FindAllIndex = %v; want 2 matches", got)
+	}
+	set.Close()
+	set.Close()
+
+	defer func() {
+		if r := recover(); r != "re2: use of closed Set" {
+			t.Errorf("recovered %v; want panic for closed Set", r)
+		}
+	}()
+	set.Match([]byte("a"))
+}
+
+func TestSetCloseWhileMatching(t *testing.T) {
+	set, err := CompileSet([]string{`a+b`, `c`, `x+a`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	input := []byte(strings.Repeat("x", 1<<12) + "aab")
+
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() {
+				if r := recover(); r != nil && r != "re2: use of closed Set" {
+					t.Errorf("recovered %v; want panic for closed Set", r)
+				}
+			}()
+			for {
+				got := set.FindAll(input, -1)
+				sort.Ints(got)
+				if !reflect.DeepEqual(got, []int{0, 2}) {
+					t.Errorf("FindAll() = %v", got)
+					return
+				}
+			}
+		}()
+	}
+	time.Sleep(10 * time.Millisecond)
+	set.Close()
+	wg.Wait()
+}
+
+func TestSetMaxProgramSize(t *testing.T) {
+	// MaxProgramSize is not enforced for the expressions of a Set, including
+	// when they are compiled on their own to locate matches.
+	set, err := CompileSetWithOptions([]string{`a`, `[a-z]{50}`}, re2.Options{MaxProgramSize: 20})
+	if err != nil {
+		t.Fatal(err)
+	}
+	input := strings.Repeat("a", 50)
+
+	got := set.FindAllStringIndex(input, -1)
+	want := []SetMatch{{Pattern: 0, Index: []int{0, 1}}, {Pattern: 1, Index: []int{0, 50}}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("FindAllStringIndex = %v, want %v", got, want)
+	}
+
+	r, err := NewReplacer(set, []string{`x`, `y`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := r.ReplaceString(input); got != strings.Repeat("x", 50) {
+		t.Errorf("ReplaceString = %q, want %q", got, strings.Repeat("x", 50))
+	}
+
+	var matches []SetScanMatch
+	s := NewSetScanner(set, 8, func(m SetScanMatch) {
+		matches = append(matches, m)
+	})
+	_, _ = s.Write([]byte(input))
+	_, _ = s.Write([]byte(input))
+	if len(matches) != 4 {
+		t.Errorf("SetScanner matches = %v, want 4", matches)
+	}
+}
@@ -0,0 +1,57 @@
+package re2
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestInput(t *testing.T) {
+	for _, test := range findTests {
+		re := MustCompile(test.pat)
+		for _, in := range []*Input{NewInput([]byte(test.text)), NewInputString(test.text)} {
+			if got, want := re.MatchInput(in), re.MatchString(test.text); got != want {
+				t.Errorf("MatchInput() = %v, want %v: %s", got, want, test)
+			}
+			testFindIndex(&test, re.FindInputIndex(in), t)
+			testFindSubmatchIndex(&test, re.FindInputSubmatchIndex(in), t)
+			testFindAllIndex(&test, re.FindAllInputIndex(in, -1), t)
+			if in.Len() != len(test.text) {
+				t.Errorf("Len() = %d, want %d: %s", in.Len(), len(test.text), test)
+			}
+			in.Release()
+		}
+	}
+}
+
+func TestInputRelease(t *testing.T) {
+	in := NewInputString("abc")
+	in.Release()
+	// Releasing again has no effect.
+	in.Release()
+
+	defer func() {
+		if recover() == nil {
+			t.Error("MatchInput on released Input did not panic")
+		}
+	}()
+	MustCompile(`b`).MatchInput(in)
+}
+
+func TestInputManyRegexps(t *testing.T) {
+	in := NewInputString("the quick brown fox jumps over the lazy dog")
+	defer in.Release()
+
+	tests := []struct {
+		pattern string
+		want    [][]int
+	}{
+		{pattern: `the`, want: [][]int{{0, 3}, {31, 34}}},
+		{pattern: `o\w`, want: [][]int{{12, 14}, {17, 19}, {26, 28}, {41, 43}}},
+		{pattern: `cat`, want: nil},
+	}
+	for _, tt := range tests {
+		if got := MustCompile(tt.pattern).FindAllInputIndex(in, -1); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("FindAllInputIndex(%q) = %v, want %v", tt.pattern, got, tt.want)
+		}
+	}
+}
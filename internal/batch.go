@@ -0,0 +1,129 @@
+package internal
+
+import (
+	"encoding/binary"
+	"runtime"
+)
+
+// MatchStrings reports whether each of the strings in ss contains any match of
+// the regular expression re. It is like calling MatchString for each string,
+// but amortizes the cost of each call for many small inputs by matching them
+// all in a single operation.
+func (re *Regexp) MatchStrings(ss []string) []bool {
+	size := 0
+	for _, s := range ss {
+		size += len(s)
+	}
+	alloc := re.abi.startOperation(size)
+	defer re.abi.endOperation(alloc)
+
+	css := make([]cString, len(ss))
+	ptrs := make([]wasmPtr, len(ss))
+	for i, s := range ss {
+		css[i] = alloc.newCString(s)
+		ptrs[i] = nilWasmPtr
+	}
+
+	res := make([]bool, len(ss))
+	matchBatch(re, css, Unanchored, ptrs, 0, res)
+
+	runtime.KeepAlive(ss)
+	runtime.KeepAlive(re) // don't allow finalizer to run during method
+	return res
+}
+
+// FindStringSubmatchIndexBatch returns the result of FindStringSubmatchIndex
+// for each of the strings in ss, matching them all in a single operation as
+// with MatchStrings.
+func (re *Regexp) FindStringSubmatchIndexBatch(ss []string) [][]int {
+	size := 0
+	for _, s := range ss {
+		size += len(s) + 8*re.numMatches
+	}
+	alloc := re.abi.startOperation(size)
+	defer re.abi.endOperation(alloc)
+
+	css := make([]cString, len(ss))
+	arrs := make([]cStringArray, len(ss))
+	ptrs := make([]wasmPtr, len(ss))
+	for i, s := range ss {
+		css[i] = alloc.newCString(s)
+		arrs[i] = alloc.newCStringArray(re.numMatches)
+		ptrs[i] = arrs[i].ptr
+	}
+	defer func() {
+		for _, arr := range arrs {
+			arr.free()
+		}
+	}()
+
+	matched := make([]bool, len(ss))
+	matchBatch(re, css, Unanchored, ptrs, uint32(re.numMatches), matched)
+
+	res := make([][]int, len(ss))
+	for i := range ss {
+		if !matched[i] {
+			continue
+		}
+		loc := make([]int, 0, 2*re.numMatches)
+		readMatches(&alloc, css[i], ptrs[i], re.numMatches, func(match []int) bool {
+			loc = append(loc, match...)
+			return true
+		})
+		res[i] = loc
+	}
+
+	runtime.KeepAlive(ss)
+	runtime.KeepAlive(arrs)
+	runtime.KeepAlive(re) // don't allow finalizer to run during method
+	return res
+}
+
+// FindAllBatch returns the result of FindAll for each of the inputs in bs,
+// matching them all in a single operation. It amortizes the cost of each call
+// for many small inputs.
+func (set *Set) FindAllBatch(bs [][]byte, n int) [][]int {
+	res := make([][]int, len(bs))
+	if n == 0 {
+		return res
+	}
+	if n < 0 {
+		n = len(set.exprs)
+	}
+
+	size := 0
+	for _, b := range bs {
+		size += len(b) + 8*n
+	}
+	alloc := set.abi.startOperation(size)
+	defer set.abi.endOperation(alloc)
+
+	css := make([]cString, len(bs))
+	arrs := make([]cStringArray, len(bs))
+	ptrs := make([]wasmPtr, len(bs))
+	for i, b := range bs {
+		css[i] = alloc.newCStringFromBytes(b)
+		arrs[i] = alloc.newCStringArray(n)
+		ptrs[i] = arrs[i].ptr
+	}
+	defer func() {
+		for _, arr := range arrs {
+			arr.free()
+		}
+	}()
+
+	counts := make([]int, len(bs))
+	setMatchBatch(set, css, ptrs, n, counts)
+
+	for i := range bs {
+		matches := alloc.read(ptrs[i], n*4)
+		for j := 0; j < counts[i] && j < n; j++ {
+			res[i] = append(res[i], int(binary.LittleEndian.Uint32(matches[j*4:])))
+		}
+	}
+
+	runtime.KeepAlive(bs)
+	runtime.KeepAlive(arrs)
+	runtime.KeepAlive(set) // don't allow finalizer to run during method
+	return res
+}
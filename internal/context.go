@@ -0,0 +1,287 @@
+package internal
+
+import (
+	"context"
+	"encoding/binary"
+	"runtime"
+	"unicode/utf8"
+)
+
+// contextChunk is the number of bytes searched at a time by the Context
+// methods, checking the context in between.
+const contextChunk = 64 << 10
+
+// MatchContext is like Match but returns the error of ctx if it is done before
+// the search completes.
+//
+// A single search in re2 cannot be interrupted, so the input is searched in
+// chunks, checking ctx in between. A chunk is enlarged while a match may
+// continue past its end, so ctx may be checked less often for expressions
+// with long matches. The search has stopped when MatchContext returns.
+func (re *Regexp) MatchContext(ctx context.Context, b []byte) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
+	alloc := re.abi.startOperation(len(b) + 8)
+	defer re.abi.endOperation(alloc)
+
+	cs := alloc.newCStringFromBytes(b)
+	matchArr := alloc.newCStringArray(1)
+	defer matchArr.free()
+
+	loc, err := re.searchContext(ctx, &alloc, b, "", cs, 0, Unanchored, 0, matchArr)
+
+	runtime.KeepAlive(b)
+	runtime.KeepAlive(matchArr)
+	runtime.KeepAlive(re) // don't allow finalizer to run during method
+
+	if err != nil {
+		return false, err
+	}
+	return loc != nil, nil
+}
+
+// FindAllIndexContext is like FindAllIndex but returns the error of ctx if it
+// is done before the search completes. As with MatchContext, the input is
+// searched in chunks, and ctx is also checked between matches.
+func (re *Regexp) FindAllIndexContext(ctx context.Context, b []byte, n int) ([][]int, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	alloc := re.abi.startOperation(len(b) + 8)
+	defer re.abi.endOperation(alloc)
+
+	cs := alloc.newCStringFromBytes(b)
+	matchArr := alloc.newCStringArray(1)
+	defer matchArr.free()
+
+	if n < 0 {
+		n = cs.length + 1
+	}
+
+	var matches [][]int
+	prevMatchEnd := -1
+	pos := 0
+	for pos < cs.length+1 && len(matches) < n {
+		match, err := re.searchContext(ctx, &alloc, b, "", cs, pos, Unanchored, 1, matchArr)
+		if err != nil {
+			return nil, err
+		}
+		if match == nil {
+			break
+		}
+
+		pos = nextPos(b, "", pos, match[1])
+		// Check if it's an empty match following a match, which we ignore.
+		if match[0] != match[1] || match[0] != prevMatchEnd {
+			matches = append(matches, match)
+		}
+		prevMatchEnd = match[1]
+	}
+
+	runtime.KeepAlive(b)
+	runtime.KeepAlive(matchArr)
+	runtime.KeepAlive(re) // don't allow finalizer to run during method
+
+	return matches, nil
+}
+
+// FindAllContext is like FindAll but returns the error of ctx if it is done
+// before the search completes. As with Regexp.MatchContext, the input is
+// searched with the set in chunks, checking ctx in between, so the search has
+// stopped when it returns. Patterns with empty-width assertions, such as ^, $
+// or \b, can't be matched within a chunk and are searched for separately,
+// which is slower. The indices are in increasing order.
+func (set *Set) FindAllContext(ctx context.Context, b []byte, n int) ([]int, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if n == 0 {
+		return nil, nil
+	}
+	if n < 0 {
+		n = len(set.exprs)
+	}
+
+	nexprs := max(len(set.exprs), 1)
+	alloc := set.abi.startOperation(len(b) + nexprs*8)
+	defer set.abi.endOperation(alloc)
+
+	cs := alloc.newCStringFromBytes(b)
+	matchArr := alloc.newCStringArray(nexprs)
+	defer matchArr.free()
+
+	found, err := set.searchContext(ctx, &alloc, b, cs, matchArr)
+	if err != nil {
+		return nil, err
+	}
+
+	contextFree := set.contextFreePatterns()
+	var matches []int
+	for i := 0; i < len(set.exprs) && len(matches) < n; i++ {
+		if !contextFree[i] {
+			re, err := set.regexp(i)
+			if err != nil {
+				return nil, err
+			}
+			loc, err := re.searchContext(ctx, &alloc, b, "", cs, 0, set.anchor, 0, matchArr)
+			if err != nil {
+				return nil, err
+			}
+			found[i] = loc != nil
+		}
+		if found[i] {
+			matches = append(matches, i)
+		}
+	}
+
+	runtime.KeepAlive(b)
+	runtime.KeepAlive(matchArr)
+	runtime.KeepAlive(set) // don't allow finalizer to run during method
+
+	return matches, nil
+}
+
+// searchContext reports which of the patterns without empty-width assertions
+// match cs. As with Regexp.searchContext, the set searches cs in chunks,
+// checking ctx in between, and the next chunk starts at the leftmost match of
+// any pattern which may continue past the end of the previous one. arr must
+// hold a match for each pattern.
+func (set *Set) searchContext(ctx context.Context, alloc *allocation, bsrc []byte, cs cString, arr cStringArray) ([]bool, error) {
+	found := make([]bool, len(set.exprs))
+	remaining := 0
+	for _, ok := range set.contextFreePatterns() {
+		if ok {
+			remaining++
+		}
+	}
+
+	done := ctx.Done()
+	pos := 0
+	size := contextChunk
+	for remaining > 0 {
+		select {
+		case <-done:
+			return nil, ctx.Err()
+		default:
+		}
+
+		end := cs.length
+		if pos+size < end {
+			end = runeStart(bsrc, "", pos+size, set.opts.Latin1)
+		}
+
+		// A match anchored at both ends can only be found with the whole input.
+		if end == cs.length || set.anchor != AnchorBoth {
+			chunk := cs
+			if pos > 0 || end < cs.length {
+				chunk = cs.slice(pos, end)
+			}
+			count := setMatch(set, chunk, arr.ptr, len(set.exprs))
+			matched := alloc.read(arr.ptr, len(set.exprs)*4)
+			for j := 0; j < count && j < len(set.exprs); j++ {
+				i := int(binary.LittleEndian.Uint32(matched[j*4:]))
+				// A pattern with assertions may only match within the chunk.
+				if set.contextFree[i] && !found[i] {
+					found[i] = true
+					remaining--
+				}
+			}
+		}
+		if end == cs.length {
+			break
+		}
+
+		p := pos
+		if alternate := set.alternation(); alternate != nil {
+			p = alternate.partialStart(alloc, cs, pos, end, arr)
+		}
+		switch {
+		case set.anchor != Unanchored && p != pos:
+			// No more matches can start at the anchored position.
+			return found, nil
+		case p < 0:
+			pos = end
+		case p == pos:
+			size *= 2
+		default:
+			pos = p
+		}
+	}
+	return found, nil
+}
+
+// searchContext returns the leftmost match of re in cs from pos, as nmatch
+// index pairs, or nil if there is none. If nmatch is 0, a non-nil empty slice
+// is returned for any match, not necessarily the leftmost. The input is
+// searched in chunks of contextChunk bytes, checking ctx in between. A match
+// found in a chunk is only returned once no match starting at or before it
+// may continue past the chunk, which is otherwise enlarged. arr must hold at
+// least max(nmatch, 1) matches.
+func (re *Regexp) searchContext(ctx context.Context, alloc *allocation, bsrc []byte, src string, cs cString, pos int, anchor Anchor, nmatch int, arr cStringArray) ([]int, error) {
+	done := ctx.Done()
+	size := contextChunk
+	for {
+		select {
+		case <-done:
+			return nil, ctx.Err()
+		default:
+		}
+
+		end := cs.length
+		if pos+size < end {
+			end = runeStart(bsrc, src, pos+size, re.opts.Latin1)
+		}
+
+		var loc []int
+		// A match anchored at both ends can only be found with the whole input.
+		if (end == cs.length || anchor != AnchorBoth) && matchRange(re, cs, pos, end, anchor, arr.ptr, uint32(nmatch)) {
+			loc = make([]int, 0, 2*nmatch)
+			readMatches(alloc, cs, arr.ptr, nmatch, func(match []int) bool {
+				loc = append(loc, match...)
+				return true
+			})
+			if nmatch == 0 {
+				return loc, nil
+			}
+		}
+		if end == cs.length {
+			return loc, nil
+		}
+
+		p := re.partialStart(alloc, cs, pos, end, arr)
+		switch {
+		case loc != nil && (p < 0 || p > loc[0]):
+			return loc, nil
+		case anchor != Unanchored && p != pos:
+			// No match can start at the anchored position.
+			return nil, nil
+		case p < 0:
+			pos = end
+		case p == pos:
+			size *= 2
+		default:
+			pos = p
+		}
+	}
+}
+
+// runeStart returns i moved back to the start of a rune of the input, unless
+// it is Latin-1.
+func runeStart(bsrc []byte, src string, i int, latin1 bool) int {
+	for j := 1; j < utf8.UTFMax && !latin1 && i > 0; j++ {
+		var c byte
+		if bsrc != nil {
+			c = bsrc[i]
+		} else {
+			c = src[i]
+		}
+		if utf8.RuneStart(c) {
+			break
+		}
+		i--
+	}
+	return i
+}
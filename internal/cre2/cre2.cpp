@@ -188,6 +188,12 @@ cre2_program_size (const cre2_regexp_t *re)
   return TO_CONST_RE2(re)->ProgramSize();
 }
 
+int
+cre2_reverse_program_size (const cre2_regexp_t *re)
+{
+  return TO_CONST_RE2(re)->ReverseProgramSize();
+}
+
 
 /** --------------------------------------------------------------------
  ** Named capture group iteration.
@@ -701,12 +707,16 @@ cre2_set_compile(cre2_set *set)
 }
 
 // Match the set of regex against text and store indices of matching regexes in match array.
-// Returns the number of regexes which match.
+// Returns the number of regexes which match. If match is NULL, only reports whether any
+// regex matches, returning 1 or 0, which allows the match to stop early.
 size_t
 cre2_set_match(cre2_set *set, const char *text, size_t text_len, int *match, size_t match_len)
 {
   RE2::Set *s = TO_RE2_SET(set);
   re2::StringPiece data(text, static_cast<int>(text_len));
+  if (match == NULL) {
+    return s->Match(data, NULL) ? 1 : 0;
+  }
   std::vector<int> v;
   bool does_match = s->Match(data, &v);
   if (!does_match) {
@@ -717,4 +727,22 @@ cre2_set_match(cre2_set *set, const char *text, size_t text_len, int *match, siz
   return v.size();
 }
 
+// Like cre2_set_match but a failed match is distinguished from no match. Returns the
+// negated RE2::Set::ErrorKind if the match failed, for example when the DFA ran out of memory.
+int
+cre2_set_match_checked(cre2_set *set, const char *text, size_t text_len, int *match, size_t match_len)
+{
+  RE2::Set *s = TO_RE2_SET(set);
+  re2::StringPiece data(text, static_cast<int>(text_len));
+  std::vector<int> v;
+  RE2::Set::ErrorInfo info;
+  bool does_match = s->Match(data, &v, &info);
+  if (!does_match) {
+    return -static_cast<int>(info.kind);
+  }
+  size_t min = v.size() < match_len ? v.size() : match_len;
+  std::copy(v.begin(), v.begin() + min, match);
+  return static_cast<int>(v.size());
+}
+
 /* end of file */
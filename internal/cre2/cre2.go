@@ -15,6 +15,11 @@ int cre2_match(void* re, void* text, int text_len, int startpos, int endpos, int
 int cre2_find_and_consume_re(void* re, void* text, void* match, int nmatch);
 int cre2_global_replace_re(void* re, void* textAndTarget, void* rewrite);
 int cre2_num_capturing_groups(void* re);
+int cre2_program_size(void* re);
+int cre2_reverse_program_size(void* re);
+int cre2_possible_match_range(void* re, void* min, void* max, int maxlen);
+int cre2_extract_re(void* re, void* text, void* rewrite, void* target);
+int cre2_check_rewrite_string(void* re, void* rewrite, void* errmsg);
 void* cre2_named_groups_iter_new(void* re);
 bool cre2_named_groups_iter_next(void* iter, void** name, int* index);
 void cre2_named_groups_iter_delete(void* iter);
@@ -24,13 +29,21 @@ void cre2_opt_delete(void* opts);
 void cre2_opt_set_log_errors(void* opt, int flag);
 void cre2_opt_set_longest_match(void* opt, int flag);
 void cre2_opt_set_posix_syntax(void* opt, int flag);
+void cre2_opt_set_literal(void* opt, int flag);
+void cre2_opt_set_never_nl(void* opt, int flag);
+void cre2_opt_set_dot_nl(void* opt, int flag);
+void cre2_opt_set_never_capture(void* opt, int flag);
 void cre2_opt_set_case_sensitive(void* opt, int flag);
+void cre2_opt_set_perl_classes(void* opt, int flag);
+void cre2_opt_set_word_boundary(void* opt, int flag);
+void cre2_opt_set_one_line(void* opt, int flag);
 void cre2_opt_set_latin1_encoding(void* opt);
 void cre2_opt_set_max_mem(void* opt, int64_t size);
 void* cre2_set_new(void* opt, int anchor);
 void* cre2_set_add(void* set, void* pattern, size_t pattern_len);
 int cre2_set_compile(void* set);
 size_t cre2_set_match(void* set, void* text, size_t text_len, void* match, size_t nmatch);
+int cre2_set_match_checked(void* set, void* text, size_t text_len, void* match, size_t nmatch);
 void cre2_set_delete(void* set);
 
 void* malloc(size_t size);
@@ -62,8 +75,8 @@ func FindAndConsume(rePtr unsafe.Pointer, textPtr unsafe.Pointer, matchPtr unsaf
 	return C.cre2_find_and_consume_re(rePtr, textPtr, matchPtr, C.int(nMatch)) > 0
 }
 
-func GlobalReplace(rePtr unsafe.Pointer, textAndTargetPtr unsafe.Pointer, rewritePtr unsafe.Pointer) bool {
-	return C.cre2_global_replace_re(rePtr, textAndTargetPtr, rewritePtr) > 0
+func GlobalReplace(rePtr unsafe.Pointer, textAndTargetPtr unsafe.Pointer, rewritePtr unsafe.Pointer) int {
+	return int(C.cre2_global_replace_re(rePtr, textAndTargetPtr, rewritePtr))
 }
 
 func Match(rePtr unsafe.Pointer, textPtr unsafe.Pointer, textLen int, startPos int, endPos int, anchor int, matchArr unsafe.Pointer, nMatch int) bool {
@@ -89,6 +102,26 @@ func NumCapturingGroups(rePtr unsafe.Pointer) int {
 	return int(C.cre2_num_capturing_groups(rePtr))
 }
 
+func ProgramSize(rePtr unsafe.Pointer) int {
+	return int(C.cre2_program_size(rePtr))
+}
+
+func ReverseProgramSize(rePtr unsafe.Pointer) int {
+	return int(C.cre2_reverse_program_size(rePtr))
+}
+
+func PossibleMatchRange(rePtr unsafe.Pointer, minPtr unsafe.Pointer, maxPtr unsafe.Pointer, maxLen int) int {
+	return int(C.cre2_possible_match_range(rePtr, minPtr, maxPtr, C.int(maxLen)))
+}
+
+func Extract(rePtr unsafe.Pointer, textPtr unsafe.Pointer, rewritePtr unsafe.Pointer, targetPtr unsafe.Pointer) int {
+	return int(C.cre2_extract_re(rePtr, textPtr, rewritePtr, targetPtr))
+}
+
+func CheckRewriteString(rePtr unsafe.Pointer, rewritePtr unsafe.Pointer, errPtr unsafe.Pointer) int {
+	return int(C.cre2_check_rewrite_string(rePtr, rewritePtr, errPtr))
+}
+
 func NewOpt() unsafe.Pointer {
 	return C.cre2_opt_new()
 }
@@ -109,6 +142,34 @@ func OptSetPosixSyntax(opt unsafe.Pointer, flag bool) {
 	C.cre2_opt_set_posix_syntax(opt, cFlag(flag))
 }
 
+func OptSetLiteral(opt unsafe.Pointer, flag bool) {
+	C.cre2_opt_set_literal(opt, cFlag(flag))
+}
+
+func OptSetNeverNL(opt unsafe.Pointer, flag bool) {
+	C.cre2_opt_set_never_nl(opt, cFlag(flag))
+}
+
+func OptSetDotNL(opt unsafe.Pointer, flag bool) {
+	C.cre2_opt_set_dot_nl(opt, cFlag(flag))
+}
+
+func OptSetNeverCapture(opt unsafe.Pointer, flag bool) {
+	C.cre2_opt_set_never_capture(opt, cFlag(flag))
+}
+
+func OptSetPerlClasses(opt unsafe.Pointer, flag bool) {
+	C.cre2_opt_set_perl_classes(opt, cFlag(flag))
+}
+
+func OptSetWordBoundary(opt unsafe.Pointer, flag bool) {
+	C.cre2_opt_set_word_boundary(opt, cFlag(flag))
+}
+
+func OptSetOneLine(opt unsafe.Pointer, flag bool) {
+	C.cre2_opt_set_one_line(opt, cFlag(flag))
+}
+
 func OptSetCaseSensitive(opt unsafe.Pointer, flag bool) {
 	C.cre2_opt_set_case_sensitive(opt, cFlag(flag))
 }
@@ -137,6 +198,10 @@ func SetMatch(set unsafe.Pointer, textPtr unsafe.Pointer, textLen int, match uns
 	return int(C.cre2_set_match(set, textPtr, C.size_t(textLen), match, C.size_t(nMatch)))
 }
 
+func SetMatchChecked(set unsafe.Pointer, textPtr unsafe.Pointer, textLen int, match unsafe.Pointer, nMatch int) int {
+	return int(C.cre2_set_match_checked(set, textPtr, C.size_t(textLen), match, C.size_t(nMatch)))
+}
+
 func SetDelete(ptr unsafe.Pointer) {
 	C.cre2_set_delete(ptr)
 }
@@ -121,6 +121,7 @@ cre2_decl const char * cre2_pattern	(const cre2_regexp_t *re);
 cre2_decl int cre2_error_code		(const cre2_regexp_t *re);
 cre2_decl int cre2_num_capturing_groups	(const cre2_regexp_t *re);
 cre2_decl int cre2_program_size		(const cre2_regexp_t *re);
+cre2_decl int cre2_reverse_program_size	(const cre2_regexp_t *re);
 
 /* named capture information */
 cre2_decl int cre2_find_named_capturing_groups  (const cre2_regexp_t *re, const char *name);
@@ -325,10 +326,16 @@ cre2_decl int cre2_set_add_simple(cre2_set *set, const char *pattern);
 cre2_decl int cre2_set_compile(cre2_set *set);
 
 /* Match the set of regex against text and store indices of matching regexes in match array.
- * Returns the number of regexes which match. */
+ * Returns the number of regexes which match. If match is NULL, only reports whether any
+ * regex matches, returning 1 or 0. */
 cre2_decl size_t cre2_set_match(cre2_set *set, const char *text, size_t text_len,
 					 int *match, size_t match_len);
 
+/* Like cre2_set_match but returns the negated RE2::Set::ErrorKind if the match failed,
+ * for example because the DFA ran out of memory. */
+cre2_decl int cre2_set_match_checked(cre2_set *set, const char *text, size_t text_len,
+					 int *match, size_t match_len);
+
 
 /** --------------------------------------------------------------------
  ** Done.
@@ -0,0 +1,133 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"regexp/syntax"
+	"strings"
+)
+
+// Error describes a failure to parse a regular expression. It carries the
+// same information as *syntax.Error, which it unwraps to, along with the
+// location of the offending fragment in the expression.
+type Error struct {
+	// Code is the kind of error, as reported by regexp/syntax.
+	Code syntax.ErrorCode
+	// Expr is the fragment of the expression that caused the error.
+	Expr string
+	// Offset is the byte offset of Expr in the expression, or -1 if unknown.
+	Offset int
+
+	msg string
+}
+
+func newError(code syntax.ErrorCode, msg string, offset int, errArg string) *Error {
+	return &Error{
+		Code:   code,
+		Expr:   errArg,
+		Offset: offset,
+		msg:    msg,
+	}
+}
+
+// maxErrorOccurrences bounds the number of occurrences of the fragment of an
+// error checked by errorOffset, each costing a compilation.
+const maxErrorOccurrences = 64
+
+// errorOffset returns the offset in expr of the fragment errArg which re2
+// failed to parse with errCode, or -1 if it is not found. re2 reports the
+// fragment but not its position, and it parses from left to right, so when
+// the fragment occurs more than once, the error is at the last occurrence
+// where the expression before it does not already fail with errCode. -1 is
+// also returned for a fragment occurring too many times to check.
+func errorOffset(abi *libre2ABI, expr string, opts CompileOptions, errCode int, errArg string) int {
+	if errArg == "" {
+		return -1
+	}
+	offset := strings.Index(expr, errArg)
+	if offset < 0 {
+		return -1
+	}
+	for i, checked := offset+1, 0; i < len(expr); i++ {
+		next := strings.Index(expr[i:], errArg)
+		if next < 0 {
+			break
+		}
+		if checked++; checked > maxErrorOccurrences {
+			return -1
+		}
+		i += next
+		if prefixErrorCode(abi, expr[:i], opts) == errCode {
+			break
+		}
+		offset = i
+	}
+	return offset
+}
+
+// prefixErrorCode returns the re2 error code of compiling the prefix of an
+// expression, which is 0 if it is valid.
+func prefixErrorCode(abi *libre2ABI, prefix string, opts CompileOptions) int {
+	alloc := abi.startOperation(len(prefix) + 2)
+	defer abi.endOperation(alloc)
+
+	rePtr := newRE(abi, alloc.newCString(prefix), opts)
+	code, _ := reError(abi, rePtr)
+	deleteRE(abi, rePtr)
+	return code
+}
+
+func (e *Error) Error() string {
+	return e.msg
+}
+
+// Unwrap returns the equivalent *syntax.Error.
+func (e *Error) Unwrap() error {
+	return &syntax.Error{Code: e.Code, Expr: e.Expr}
+}
+
+// ProgramSizeError is returned when compiling a regular expression with a
+// program larger than CompileOptions.MaxProgramSize. It unwraps to a
+// *syntax.Error with code syntax.ErrLarge, or to errors.ErrUnsupported if
+// the size of the program could not be determined.
+type ProgramSizeError struct {
+	// Expr is the expression that was compiled.
+	Expr string
+	// Size is the size of the compiled program, or -1 if it could not be
+	// determined, in which case the limit could not be enforced.
+	Size int
+	// Max is the configured limit.
+	Max int
+}
+
+func (e *ProgramSizeError) Error() string {
+	if e.Size < 0 {
+		return fmt.Sprintf("regexp: program size unknown, cannot enforce limit of %d", e.Max)
+	}
+	return fmt.Sprintf("regexp: program size %d exceeds limit of %d", e.Size, e.Max)
+}
+
+// Unwrap returns the equivalent *syntax.Error, or errors.ErrUnsupported if
+// the size is unknown.
+func (e *ProgramSizeError) Unwrap() error {
+	if e.Size < 0 {
+		return errors.ErrUnsupported
+	}
+	return &syntax.Error{Code: syntax.ErrLarge, Expr: e.Expr}
+}
+
+// SetError describes a failure to compile one of the expressions of a Set.
+type SetError struct {
+	// Index is the index of the invalid expression in the Set.
+	Index int
+	// Err is the error parsing the expression, usually an *Error.
+	Err error
+}
+
+func (e *SetError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *SetError) Unwrap() error {
+	return e.Err
+}
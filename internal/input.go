@@ -0,0 +1,185 @@
+package internal
+
+import (
+	"runtime"
+	"sync/atomic"
+)
+
+// Input is text prepared for matching by copying it into the memory used by
+// re2 once, so it can be matched by many Regexp and Set without copying it for
+// each call. Indices returned by the methods matching an Input refer to the
+// text the Input was created from.
+//
+// An Input holds memory until it is released, which happens when it is garbage
+// collected or, to free it promptly, when Release is called. It is safe for
+// concurrent use until it is released.
+type Input struct {
+	abi   *libre2ABI
+	alloc allocation
+	cs    cString
+
+	// b or s is the text, needed to step over runes after empty matches.
+	b []byte
+	s string
+
+	released uint32
+}
+
+// NewInput returns an Input holding the text b. b must not be modified while
+// the Input is in use.
+func NewInput(b []byte) *Input {
+	abi := newABI()
+	alloc := abi.startOperation(len(b))
+	in := &Input{
+		abi:   abi,
+		alloc: alloc,
+		b:     b,
+	}
+	if b == nil {
+		// Keep b non-nil to distinguish it from string input.
+		in.b = []byte{}
+	}
+	in.cs = in.alloc.newCStringFromBytes(in.b)
+	setInputFinalizer(in)
+	return in
+}
+
+// NewInputString returns an Input holding the text s.
+func NewInputString(s string) *Input {
+	abi := newABI()
+	alloc := abi.startOperation(len(s))
+	in := &Input{
+		abi:   abi,
+		alloc: alloc,
+		s:     s,
+	}
+	in.cs = in.alloc.newCString(s)
+	setInputFinalizer(in)
+	return in
+}
+
+func setInputFinalizer(in *Input) {
+	// Use func(interface{}) form for nottinygc compatibility.
+	runtime.SetFinalizer(in, func(obj interface{}) {
+		if i, ok := obj.(*Input); ok {
+			i.Release()
+		}
+	})
+}
+
+// Len returns the length in bytes of the text of the Input.
+func (in *Input) Len() int {
+	return in.cs.length
+}
+
+// Release frees the memory held by the Input. The Input must not be used
+// after it is released. Calling Release more than once has no effect.
+func (in *Input) Release() {
+	if !atomic.CompareAndSwapUint32(&in.released, 0, 1) {
+		return
+	}
+	in.abi.endOperation(in.alloc)
+}
+
+func (in *Input) checkReleased() {
+	if atomic.LoadUint32(&in.released) != 0 {
+		panic("re2: use of released Input")
+	}
+}
+
+// MatchInput reports whether the text of the Input contains any match of the
+// regular expression re.
+func (re *Regexp) MatchInput(in *Input) bool {
+	in.checkReleased()
+
+	res := match(re, in.cs, Unanchored, nilWasmPtr, 0)
+
+	runtime.KeepAlive(in)
+	runtime.KeepAlive(re) // don't allow finalizer to run during method
+	return res
+}
+
+// FindInputIndex is like FindIndex but matches the text of the Input.
+func (re *Regexp) FindInputIndex(in *Input) []int {
+	return re.findInput(in, 1)
+}
+
+// FindInputSubmatchIndex is like FindSubmatchIndex but matches the text of
+// the Input.
+func (re *Regexp) FindInputSubmatchIndex(in *Input) []int {
+	return re.findInput(in, re.numMatches)
+}
+
+func (re *Regexp) findInput(in *Input, nmatch int) []int {
+	in.checkReleased()
+
+	alloc := re.abi.startOperation(8 * nmatch)
+	defer re.abi.endOperation(alloc)
+
+	matchArr := alloc.newCStringArray(nmatch)
+	defer matchArr.free()
+
+	if !match(re, in.cs, Unanchored, matchArr.ptr, uint32(nmatch)) {
+		return nil
+	}
+
+	res := make([]int, 0, 2*nmatch)
+	readMatches(&alloc, in.cs, matchArr.ptr, nmatch, func(match []int) bool {
+		res = append(res, match...)
+		return true
+	})
+
+	runtime.KeepAlive(in)
+	runtime.KeepAlive(matchArr)
+	runtime.KeepAlive(re) // don't allow finalizer to run during method
+	return res
+}
+
+// FindAllInputIndex is like FindAllIndex but matches the text of the Input.
+func (re *Regexp) FindAllInputIndex(in *Input, n int) [][]int {
+	in.checkReleased()
+
+	alloc := re.abi.startOperation(16)
+	defer re.abi.endOperation(alloc)
+
+	var matches [][]int
+
+	re.findAll(&alloc, in.b, in.s, in.cs, n, func(match []int) bool {
+		matches = append(matches, append([]int(nil), match...))
+		return true
+	})
+
+	runtime.KeepAlive(in)
+	return matches
+}
+
+// MatchInput reports whether any of the regular expressions in the Set match
+// the text of the Input.
+func (set *Set) MatchInput(in *Input) bool {
+	in.checkReleased()
+
+	res := setMatch(set, in.cs, nilWasmPtr, 0) > 0
+
+	runtime.KeepAlive(in)
+	runtime.KeepAlive(set) // don't allow finalizer to run during method
+	return res
+}
+
+// FindAllInput is like FindAll but matches the text of the Input.
+func (set *Set) FindAllInput(in *Input, n int) []int {
+	in.checkReleased()
+
+	if n == 0 {
+		return nil
+	}
+	if n < 0 {
+		n = len(set.exprs)
+	}
+	alloc := set.abi.startOperation(8 + n*8)
+	defer set.abi.endOperation(alloc)
+
+	res := set.appendMatches(&alloc, in.cs, n, nil)
+
+	runtime.KeepAlive(in)
+	return res
+}
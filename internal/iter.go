@@ -0,0 +1,143 @@
+package internal
+
+import (
+	"iter"
+	"runtime"
+)
+
+// All returns an iterator over all successive matches of the expression in b,
+// as defined by the 'All' description in the package comment. Matches are
+// found as the iterator is consumed, so breaking out of the loop stops the search.
+func (re *Regexp) All(b []byte) iter.Seq[[]byte] {
+	return func(yield func([]byte) bool) {
+		re.iterAll(b, "", func(match []int) bool {
+			return yield(matchedBytes(b, match))
+		})
+	}
+}
+
+// AllIndex is like All but yields the location of each match, as returned by
+// FindIndex.
+func (re *Regexp) AllIndex(b []byte) iter.Seq[[]int] {
+	return func(yield func([]int) bool) {
+		re.iterAll(b, "", func(match []int) bool {
+			return yield(append([]int(nil), match...))
+		})
+	}
+}
+
+// AllString returns an iterator over all successive matches of the expression
+// in s, as defined by the 'All' description in the package comment.
+func (re *Regexp) AllString(s string) iter.Seq[string] {
+	return func(yield func(string) bool) {
+		re.iterAll(nil, s, func(match []int) bool {
+			return yield(matchedString(s, match))
+		})
+	}
+}
+
+// AllStringIndex is like AllString but yields the location of each match, as
+// returned by FindStringIndex.
+func (re *Regexp) AllStringIndex(s string) iter.Seq[[]int] {
+	return func(yield func([]int) bool) {
+		re.iterAll(nil, s, func(match []int) bool {
+			return yield(append([]int(nil), match...))
+		})
+	}
+}
+
+// AllSubmatch is like All but yields the match and its subexpressions, as
+// returned by FindSubmatch.
+func (re *Regexp) AllSubmatch(b []byte) iter.Seq[[][]byte] {
+	return func(yield func([][]byte) bool) {
+		re.iterAllSubmatch(b, "", func(match []int) bool {
+			matched := make([][]byte, len(match)/2)
+			for i := 0; i < len(match); i += 2 {
+				matched[i/2] = matchedBytes(b, match[i:i+2])
+			}
+			return yield(matched)
+		})
+	}
+}
+
+// AllSubmatchIndex is like All but yields the locations of the match and its
+// subexpressions, as returned by FindSubmatchIndex.
+func (re *Regexp) AllSubmatchIndex(b []byte) iter.Seq[[]int] {
+	return func(yield func([]int) bool) {
+		re.iterAllSubmatch(b, "", yield)
+	}
+}
+
+// AllStringSubmatch is like AllString but yields the match and its
+// subexpressions, as returned by FindStringSubmatch.
+func (re *Regexp) AllStringSubmatch(s string) iter.Seq[[]string] {
+	return func(yield func([]string) bool) {
+		re.iterAllSubmatch(nil, s, func(match []int) bool {
+			matched := make([]string, len(match)/2)
+			for i := 0; i < len(match); i += 2 {
+				matched[i/2] = matchedString(s, match[i:i+2])
+			}
+			return yield(matched)
+		})
+	}
+}
+
+// AllStringSubmatchIndex is like AllString but yields the locations of the
+// match and its subexpressions, as returned by FindStringSubmatchIndex.
+func (re *Regexp) AllStringSubmatchIndex(s string) iter.Seq[[]int] {
+	return func(yield func([]int) bool) {
+		re.iterAllSubmatch(nil, s, yield)
+	}
+}
+
+func (re *Regexp) iterAll(bsrc []byte, src string, deliver func(match []int) bool) {
+	alloc := re.abi.startOperation(len(bsrc) + len(src) + 16)
+	defer re.abi.endOperation(alloc)
+
+	cs := newIterCString(&alloc, bsrc, src)
+	re.findAll(&alloc, bsrc, src, cs, -1, deliver)
+
+	runtime.KeepAlive(bsrc)
+	runtime.KeepAlive(src)
+}
+
+func (re *Regexp) iterAllSubmatch(bsrc []byte, src string, deliver func(match []int) bool) {
+	alloc := re.abi.startOperation(len(bsrc) + len(src) + 8*re.numMatches + 8)
+	defer re.abi.endOperation(alloc)
+
+	cs := newIterCString(&alloc, bsrc, src)
+	re.findAllSubmatch(&alloc, bsrc, src, cs, re.numMatches, -1, deliver)
+
+	runtime.KeepAlive(bsrc)
+	runtime.KeepAlive(src)
+}
+
+func newIterCString(alloc *allocation, bsrc []byte, src string) cString {
+	if bsrc != nil {
+		return alloc.newCStringFromBytes(bsrc)
+	}
+	return alloc.newCString(src)
+}
+
+// All returns an iterator over the indices of the patterns in the Set matching
+// the input bytes, as returned by FindAll.
+func (set *Set) All(b []byte) iter.Seq[int] {
+	return func(yield func(int) bool) {
+		for _, p := range set.FindAll(b, -1) {
+			if !yield(p) {
+				return
+			}
+		}
+	}
+}
+
+// AllString is like All but matches against the input string.
+func (set *Set) AllString(s string) iter.Seq[int] {
+	return func(yield func(int) bool) {
+		for _, p := range set.FindAllString(s, -1) {
+			if !yield(p) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,203 @@
+package internal
+
+import (
+	"fmt"
+	"regexp/syntax"
+	"runtime"
+	"strings"
+)
+
+// partialRegexp returns an expression matching at the end of the text the
+// prefixes of the matches of re, which are the matches that may continue past
+// the end of a buffered window of the input. It returns nil if the expression
+// could not be built, for example for syntax only supported by re2 such as \C.
+func (re *Regexp) partialRegexp() *Regexp {
+	re.partialOnce.Do(func() {
+		re.partial = compilePartial(re.expr, re.opts)
+	})
+	return re.partial
+}
+
+func compilePartial(expr string, opts CompileOptions) *Regexp {
+	sre, err := parseSyntax(expr, opts)
+	if err != nil {
+		return nil
+	}
+
+	pexpr := "(?:" + prefixes(sre).String() + `)\z`
+	if opts.Latin1 {
+		pexpr = utf8ToLatin1(pexpr)
+	}
+	// Flags were already applied to the parsed expression.
+	popts := CompileOptions{
+		Latin1: opts.Latin1,
+		MaxMem: opts.MaxMem,
+	}
+	p, err := Compile(pexpr, popts)
+	if err != nil {
+		return nil
+	}
+	return p
+}
+
+// parseSyntax parses expr with regexp/syntax as re2 would with opts. A
+// Latin-1 expression is converted to UTF-8.
+func parseSyntax(expr string, opts CompileOptions) (*syntax.Regexp, error) {
+	if opts.Latin1 {
+		expr = latin1ToUTF8(expr)
+	}
+
+	flags := syntax.Perl
+	if opts.Posix && !opts.OneLine {
+		// ^ and $ match at line boundaries.
+		flags &^= syntax.OneLine
+	}
+	if opts.CaseInsensitive {
+		flags |= syntax.FoldCase
+	}
+	if opts.DotNL {
+		flags |= syntax.DotNL
+	}
+	if opts.Literal {
+		flags |= syntax.Literal
+	}
+	return syntax.Parse(expr, flags) //nolint:wrapcheck // not returned to the user
+}
+
+// hasAssertion reports whether expr has an empty-width assertion, such as ^,
+// $ or \b, which depends on the text around a chunk of the input. It also
+// returns true if expr can't be parsed.
+func hasAssertion(expr string, opts CompileOptions) bool {
+	sre, err := parseSyntax(expr, opts)
+	if err != nil {
+		return true
+	}
+	return hasAssertionOp(sre)
+}
+
+func hasAssertionOp(re *syntax.Regexp) bool {
+	switch re.Op {
+	case syntax.OpBeginLine, syntax.OpEndLine, syntax.OpBeginText, syntax.OpEndText,
+		syntax.OpWordBoundary, syntax.OpNoWordBoundary:
+		return true
+	}
+	for _, sub := range re.Sub {
+		if hasAssertionOp(sub) {
+			return true
+		}
+	}
+	return false
+}
+
+// prefixes returns an expression matching the prefixes of the matches of re,
+// including the empty text and the matches themselves. Empty-width assertions
+// are dropped, so it may also match prefixes of texts that don't match re.
+func prefixes(re *syntax.Regexp) *syntax.Regexp {
+	switch re.Op {
+	case syntax.OpNoMatch:
+		return re
+	case syntax.OpLiteral:
+		// (a(b(c)?)?)? for abc.
+		var p *syntax.Regexp
+		for i := len(re.Rune) - 1; i >= 0; i-- {
+			lit := &syntax.Regexp{Op: syntax.OpLiteral, Flags: re.Flags, Rune: re.Rune[i : i+1]}
+			if p != nil {
+				lit = concatRegexp(lit, p)
+			}
+			p = &syntax.Regexp{Op: syntax.OpQuest, Sub: []*syntax.Regexp{lit}}
+		}
+		if p == nil {
+			return &syntax.Regexp{Op: syntax.OpEmptyMatch}
+		}
+		return p
+	case syntax.OpCharClass, syntax.OpAnyCharNotNL, syntax.OpAnyChar:
+		return &syntax.Regexp{Op: syntax.OpQuest, Sub: []*syntax.Regexp{re}}
+	case syntax.OpCapture:
+		return prefixes(re.Sub[0])
+	case syntax.OpStar, syntax.OpPlus:
+		star := &syntax.Regexp{Op: syntax.OpStar, Sub: re.Sub[:1]}
+		return concatRegexp(star, prefixes(re.Sub[0]))
+	case syntax.OpQuest:
+		return &syntax.Regexp{Op: syntax.OpQuest, Sub: []*syntax.Regexp{prefixes(re.Sub[0])}}
+	case syntax.OpRepeat:
+		switch re.Max {
+		case 0:
+			return &syntax.Regexp{Op: syntax.OpEmptyMatch}
+		case 1:
+			return prefixes(re.Sub[0])
+		case -1:
+			star := &syntax.Regexp{Op: syntax.OpStar, Sub: re.Sub[:1]}
+			return concatRegexp(star, prefixes(re.Sub[0]))
+		}
+		head := &syntax.Regexp{Op: syntax.OpRepeat, Min: 0, Max: re.Max - 1, Sub: re.Sub[:1]}
+		return concatRegexp(head, prefixes(re.Sub[0]))
+	case syntax.OpConcat:
+		// p(r1) | r1 (p(r2) | r2 (p(r3) | ...)).
+		p := prefixes(re.Sub[len(re.Sub)-1])
+		for i := len(re.Sub) - 2; i >= 0; i-- {
+			p = &syntax.Regexp{Op: syntax.OpAlternate, Sub: []*syntax.Regexp{
+				prefixes(re.Sub[i]),
+				concatRegexp(re.Sub[i], p),
+			}}
+		}
+		return p
+	case syntax.OpAlternate:
+		alt := &syntax.Regexp{Op: syntax.OpAlternate}
+		for _, sub := range re.Sub {
+			alt.Sub = append(alt.Sub, prefixes(sub))
+		}
+		return alt
+	}
+	// OpEmptyMatch and the empty-width assertions.
+	return &syntax.Regexp{Op: syntax.OpEmptyMatch}
+}
+
+func concatRegexp(a, b *syntax.Regexp) *syntax.Regexp {
+	return &syntax.Regexp{Op: syntax.OpConcat, Sub: []*syntax.Regexp{a, b}}
+}
+
+// partialStart returns the leftmost position in cs from pos where a match of
+// re may start that reaches end, and so may continue past it, or -1 if there
+// is none. arr must hold at least one match.
+func (re *Regexp) partialStart(alloc *allocation, cs cString, pos int, end int, arr cStringArray) int {
+	p := re.partialRegexp()
+	if p == nil {
+		// Any position may start such a match.
+		return pos
+	}
+	// Truncate the text so \z matches at end.
+	text := cString{ptr: cs.ptr, length: end}
+	if !matchFrom(p, text, pos, arr.ptr, 1) {
+		return -1
+	}
+	start := -1
+	readMatches(alloc, text, arr.ptr, 1, func(match []int) bool {
+		start = match[0]
+		return false
+	})
+
+	runtime.KeepAlive(p)
+	return start
+}
+
+func latin1ToUTF8(s string) string {
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		sb.WriteRune(rune(s[i]))
+	}
+	return sb.String()
+}
+
+// utf8ToLatin1 encodes the expression s in Latin-1, escaping the runes which
+// can't be encoded, such as those added to a class by case folding.
+func utf8ToLatin1(s string) string {
+	b := make([]byte, 0, len(s))
+	for _, r := range s {
+		if r > 0xff {
+			b = fmt.Appendf(b, `\x{%x}`, r)
+			continue
+		}
+		b = append(b, byte(r))
+	}
+	return string(b)
+}
@@ -2,8 +2,9 @@ package internal
 
 import (
 	"bytes"
-	"errors"
 	"fmt"
+	"regexp"
+	"regexp/syntax"
 	"runtime"
 	"strconv"
 	"strings"
@@ -28,9 +29,24 @@ type Regexp struct {
 	groupNames     []string
 	groupNamesOnce sync.Once
 
+	literalPrefix         string
+	literalPrefixComplete bool
+	literalPrefixOnce     sync.Once
+
+	partial     *Regexp
+	partialOnce sync.Once
+
 	abi *libre2ABI
 
+	// owner is set when re was filled in by UnmarshalText, in which case the
+	// compiled expression and its finalizer belong to owner.
+	owner *Regexp
+
 	released uint32
+	// closeMu is held for reading while the compiled expression is used, and
+	// for writing to free it. Reading costs about as much as counting the
+	// methods in progress would, see BenchmarkEnterLeave.
+	closeMu sync.RWMutex
 }
 
 // Copy returns a new Regexp object copied from re.
@@ -51,15 +67,84 @@ func (re *Regexp) Copy() *Regexp {
 	return c
 }
 
+// CompileOptions mirrors RE2::Options. The zero value is the default used
+// by Compile.
+//
+// Literal, NeverNL, DotNL, NeverCapture, PerlClasses, WordBoundary and OneLine
+// are only supported with the cgo build for now: the bundled Wasm library does
+// not export their setters, so compiling with any of them fails with an error
+// wrapping errors.ErrUnsupported until it is rebuilt.
 type CompileOptions struct {
-	Posix           bool
-	Longest         bool
+	// Posix restricts the syntax to POSIX egrep. In this mode, PerlClasses,
+	// WordBoundary and OneLine can reenable some Perl features.
+	Posix bool
+	// Longest selects leftmost-longest instead of leftmost-first matching.
+	Longest bool
+	// CaseInsensitive matches without regard to case, like (?i).
 	CaseInsensitive bool
-	Latin1          bool
+	// Latin1 treats the pattern and input as Latin-1 rather than UTF-8.
+	Latin1 bool
+	// Literal interprets the whole pattern as a literal string.
+	Literal bool
+	// NeverNL never matches \n, even if it is in the pattern.
+	NeverNL bool
+	// DotNL allows . to match \n, like (?s).
+	DotNL bool
+	// NeverCapture parses all parentheses as non-capturing.
+	NeverCapture bool
+	// PerlClasses allows Perl's \d \s \w \D \S \W when Posix is set.
+	PerlClasses bool
+	// WordBoundary allows Perl's \b \B when Posix is set.
+	WordBoundary bool
+	// OneLine makes ^ and $ only match beginning and end of text when Posix
+	// is set. Otherwise they always do unless (?m) is used.
+	OneLine bool
+	// MaxMem is the approximate memory budget in bytes for the compiled
+	// program and its DFA caches. If zero, 128MB is used, the same limit
+	// as the standard library.
+	MaxMem int64
+	// MaxProgramSize is the maximum size of the compiled program, as reported
+	// by Regexp.ProgramSize. Compiling a larger program fails with a
+	// *ProgramSizeError. If zero, the size is only limited by MaxMem. It is
+	// not enforced for the expressions of a Set. With a build of the Wasm
+	// library that cannot report the program size, any limit fails
+	// compilation rather than being ignored.
+	MaxProgramSize int
+}
+
+func (opts CompileOptions) maxMem() int64 {
+	if opts.MaxMem > 0 {
+		return opts.MaxMem
+	}
+	return maxSize
+}
+
+// Anchor restricts where in the input a match may be found, mirroring
+// RE2::Anchor.
+type Anchor int
+
+const (
+	// Unanchored allows a match anywhere in the input, the same as the
+	// methods without an anchor.
+	Unanchored Anchor = iota
+	// AnchorStart requires the match to begin at the start of the input,
+	// like RE2::Consume.
+	AnchorStart
+	// AnchorBoth requires the match to span the entire input, like
+	// RE2::FullMatch.
+	AnchorBoth
+)
+
+// cre2 returns the value of cre2_anchor_t corresponding to a.
+func (a Anchor) cre2() int {
+	return int(a) + 1
 }
 
 func Compile(expr string, opts CompileOptions) (*Regexp, error) {
 	abi := newABI()
+	if err := checkOptions(abi, opts); err != nil {
+		return nil, err
+	}
 	alloc := abi.startOperation(len(expr) + 2)
 	defer abi.endOperation(alloc)
 
@@ -67,41 +152,53 @@ func Compile(expr string, opts CompileOptions) (*Regexp, error) {
 
 	rePtr := newRE(abi, cs, opts)
 	errCode, errArg := reError(abi, rePtr)
+	offset := -1
+	if errCode != 0 {
+		offset = errorOffset(abi, expr, opts, errCode, errArg)
+	}
 	switch errCode {
 	case 0:
 	// No error.
 	case 1:
-		return nil, fmt.Errorf("error parsing regexp: unexpected error: %#q", errArg)
+		return nil, newError(syntax.ErrInternalError, fmt.Sprintf("error parsing regexp: unexpected error: %#q", errArg), offset, errArg)
 	case 2:
-		return nil, fmt.Errorf("error parsing regexp: invalid escape sequence: %#q", errArg)
+		return nil, newError(syntax.ErrInvalidEscape, fmt.Sprintf("error parsing regexp: invalid escape sequence: %#q", errArg), offset, errArg)
 	case 3:
-		return nil, fmt.Errorf("error parsing regexp: bad character class: %#q", errArg)
+		return nil, newError(syntax.ErrInvalidCharClass, fmt.Sprintf("error parsing regexp: bad character class: %#q", errArg), offset, errArg)
 	case 4:
-		return nil, fmt.Errorf("error parsing regexp: invalid character class range: %#q", errArg)
+		return nil, newError(syntax.ErrInvalidCharRange, fmt.Sprintf("error parsing regexp: invalid character class range: %#q", errArg), offset, errArg)
 	case 5:
-		return nil, fmt.Errorf("error parsing regexp: missing closing ]: %#q", errArg)
+		return nil, newError(syntax.ErrMissingBracket, fmt.Sprintf("error parsing regexp: missing closing ]: %#q", errArg), offset, errArg)
 	case 6:
-		return nil, fmt.Errorf("error parsing regexp: missing closing ): %#q", errArg)
+		return nil, newError(syntax.ErrMissingParen, fmt.Sprintf("error parsing regexp: missing closing ): %#q", errArg), offset, errArg)
 	case 7:
-		return nil, fmt.Errorf("error parsing regexp: unexpected ): %#q", errArg)
+		return nil, newError(syntax.ErrUnexpectedParen, fmt.Sprintf("error parsing regexp: unexpected ): %#q", errArg), offset, errArg)
 	case 8:
-		return nil, fmt.Errorf("error parsing regexp: trailing backslash at end of expression: %#q", errArg)
+		return nil, newError(syntax.ErrTrailingBackslash, fmt.Sprintf("error parsing regexp: trailing backslash at end of expression: %#q", errArg), offset, errArg)
 	case 9:
-		return nil, fmt.Errorf("error parsing regexp: missing argument to repetition operator: %#q", errArg)
+		return nil, newError(syntax.ErrMissingRepeatArgument, fmt.Sprintf("error parsing regexp: missing argument to repetition operator: %#q", errArg), offset, errArg)
 	case 10:
-		return nil, fmt.Errorf("error parsing regexp: bad repitition argument: %#q", errArg)
+		return nil, newError(syntax.ErrInvalidRepeatSize, fmt.Sprintf("error parsing regexp: bad repitition argument: %#q", errArg), offset, errArg)
 	case 11:
-		return nil, fmt.Errorf("error parsing regexp: invalid nested repetition operator: %#q", errArg)
+		return nil, newError(syntax.ErrInvalidRepeatOp, fmt.Sprintf("error parsing regexp: invalid nested repetition operator: %#q", errArg), offset, errArg)
 	case 12:
-		return nil, fmt.Errorf("error parsing regexp: bad perl operator: %#q", errArg)
+		return nil, newError(syntax.ErrInvalidPerlOp, fmt.Sprintf("error parsing regexp: bad perl operator: %#q", errArg), offset, errArg)
 	case 13:
-		return nil, fmt.Errorf("error parsing regexp: invalid UTF-8 in regexp: %#q", errArg)
+		return nil, newError(syntax.ErrInvalidUTF8, fmt.Sprintf("error parsing regexp: invalid UTF-8 in regexp: %#q", errArg), offset, errArg)
 	case 14:
-		return nil, fmt.Errorf("error parsing regexp: bad named capture group: %#q", errArg)
+		return nil, newError(syntax.ErrInvalidNamedCapture, fmt.Sprintf("error parsing regexp: bad named capture group: %#q", errArg), offset, errArg)
 	case 15:
 		// TODO(anuraaga): While the unit test passes, it is likely that the actual limit is currently
 		// different than regexp.
-		return nil, errors.New("error parsing regexp: expression too large")
+		return nil, newError(syntax.ErrLarge, "error parsing regexp: expression too large", -1, "")
+	}
+
+	if opts.MaxProgramSize > 0 {
+		// An unknown size fails rather than skipping the limit.
+		if size := programSize(abi, rePtr); size < 0 || size > opts.MaxProgramSize {
+			deleteRE(abi, rePtr)
+			return nil, &ProgramSizeError{Expr: expr, Size: size, Max: opts.MaxProgramSize}
+		}
 	}
 
 	// Does not include whole expression match, e.g. $0
@@ -264,7 +361,7 @@ func (re *Regexp) find(alloc *allocation, cs cString, dstCap []int) []int {
 	matchArr := alloc.newCStringArray(1)
 	defer matchArr.free()
 
-	res := match(re, cs, matchArr.ptr, 1)
+	res := match(re, cs, Unanchored, matchArr.ptr, 1)
 	if !res {
 		return nil
 	}
@@ -289,8 +386,9 @@ func (re *Regexp) FindAll(b []byte, n int) [][]byte {
 
 	var matches [][]byte
 
-	re.findAll(&alloc, b, "", cs, n, func(match []int) {
+	re.findAll(&alloc, b, "", cs, n, func(match []int) bool {
 		matches = append(matches, matchedBytes(b, match))
+		return true
 	})
 
 	return matches
@@ -308,8 +406,9 @@ func (re *Regexp) FindAllIndex(b []byte, n int) [][]int {
 
 	var matches [][]int
 
-	re.findAll(&alloc, b, "", cs, n, func(match []int) {
+	re.findAll(&alloc, b, "", cs, n, func(match []int) bool {
 		matches = append(matches, append([]int(nil), match...))
+		return true
 	})
 
 	res := matches
@@ -329,8 +428,9 @@ func (re *Regexp) FindAllString(s string, n int) []string {
 
 	var matches []string
 
-	re.findAll(&alloc, nil, s, cs, n, func(match []int) {
+	re.findAll(&alloc, nil, s, cs, n, func(match []int) bool {
 		matches = append(matches, matchedString(s, match))
+		return true
 	})
 
 	return matches
@@ -348,8 +448,9 @@ func (re *Regexp) FindAllStringIndex(s string, n int) [][]int {
 
 	var matches [][]int
 
-	re.findAll(&alloc, nil, s, cs, n, func(match []int) {
+	re.findAll(&alloc, nil, s, cs, n, func(match []int) bool {
 		matches = append(matches, append([]int(nil), match...))
+		return true
 	})
 
 	res := matches
@@ -357,7 +458,7 @@ func (re *Regexp) FindAllStringIndex(s string, n int) [][]int {
 	return res
 }
 
-func (re *Regexp) findAll(alloc *allocation, bsrc []byte, src string, cs cString, n int, deliver func(match []int)) {
+func (re *Regexp) findAll(alloc *allocation, bsrc []byte, src string, cs cString, n int, deliver func(match []int) bool) {
 	var dstCap [2]int
 
 	if n < 0 {
@@ -387,7 +488,9 @@ func (re *Regexp) findAll(alloc *allocation, bsrc []byte, src string, cs cString
 		pos = nextPos(bsrc, src, pos, match[1])
 
 		if accept {
-			deliver(match)
+			if !deliver(match) {
+				break
+			}
 			count++
 		}
 		prevMatchEnd = match[1]
@@ -414,12 +517,13 @@ func (re *Regexp) FindAllSubmatch(b []byte, n int) [][][]byte {
 
 	var matches [][][]byte
 
-	re.findAllSubmatch(&alloc, b, "", cs, re.numMatches, n, func(match []int) {
+	re.findAllSubmatch(&alloc, b, "", cs, re.numMatches, n, func(match []int) bool {
 		matched := make([][]byte, len(match)/2)
 		for i := 0; i < len(match); i += 2 {
 			matched[i/2] = matchedBytes(b, match[i:i+2])
 		}
 		matches = append(matches, matched)
+		return true
 	})
 
 	return matches
@@ -437,8 +541,9 @@ func (re *Regexp) FindAllSubmatchIndex(b []byte, n int) [][]int {
 
 	var matches [][]int
 
-	re.findAllSubmatch(&alloc, b, "", cs, re.numMatches, n, func(match []int) {
+	re.findAllSubmatch(&alloc, b, "", cs, re.numMatches, n, func(match []int) bool {
 		matches = append(matches, match)
+		return true
 	})
 
 	res := matches
@@ -458,12 +563,13 @@ func (re *Regexp) FindAllStringSubmatch(s string, n int) [][]string {
 
 	var matches [][]string
 
-	re.findAllSubmatch(&alloc, nil, s, cs, re.numMatches, n, func(match []int) {
+	re.findAllSubmatch(&alloc, nil, s, cs, re.numMatches, n, func(match []int) bool {
 		matched := make([]string, len(match)/2)
 		for i := 0; i < len(match); i += 2 {
 			matched[i/2] = matchedString(s, match[i:i+2])
 		}
 		matches = append(matches, matched)
+		return true
 	})
 
 	return matches
@@ -482,8 +588,9 @@ func (re *Regexp) FindAllStringSubmatchIndex(s string, n int) [][]int {
 
 	var matches [][]int
 
-	re.findAllSubmatch(&alloc, nil, s, cs, re.numMatches, n, func(match []int) {
+	re.findAllSubmatch(&alloc, nil, s, cs, re.numMatches, n, func(match []int) bool {
 		matches = append(matches, match)
+		return true
 	})
 
 	res := matches
@@ -491,7 +598,7 @@ func (re *Regexp) FindAllStringSubmatchIndex(s string, n int) [][]int {
 	return res
 }
 
-func (re *Regexp) findAllSubmatch(alloc *allocation, bsrc []byte, src string, cs cString, nmatch, n int, deliver func(match []int)) {
+func (re *Regexp) findAllSubmatch(alloc *allocation, bsrc []byte, src string, cs cString, nmatch, n int, deliver func(match []int) bool) {
 	if n < 0 {
 		n = cs.length + 1
 	}
@@ -525,8 +632,8 @@ func (re *Regexp) findAllSubmatch(alloc *allocation, bsrc []byte, src string, cs
 			}
 			return false
 		})
-		if accept {
-			deliver(matches)
+		if accept && !deliver(matches) {
+			break
 		}
 		count++
 
@@ -553,7 +660,7 @@ func (re *Regexp) FindSubmatch(b []byte) [][]byte {
 
 	var matches [][]byte
 
-	re.findSubmatch(&alloc, cs, func(match []int) bool {
+	re.findSubmatch(&alloc, cs, Unanchored, func(match []int) bool {
 		matches = append(matches, matchedBytes(b, match))
 		return true
 	})
@@ -574,7 +681,7 @@ func (re *Regexp) FindSubmatchIndex(b []byte) []int {
 
 	var matches []int
 
-	re.findSubmatch(&alloc, cs, func(match []int) bool {
+	re.findSubmatch(&alloc, cs, Unanchored, func(match []int) bool {
 		matches = append(matches, match...)
 		return true
 	})
@@ -592,7 +699,7 @@ func (re *Regexp) FindStringSubmatch(s string) []string {
 
 	var matches []string
 
-	re.findSubmatch(&alloc, cs, func(match []int) bool {
+	re.findSubmatch(&alloc, cs, Unanchored, func(match []int) bool {
 		matches = append(matches, matchedString(s, match))
 		return true
 	})
@@ -613,7 +720,7 @@ func (re *Regexp) FindStringSubmatchIndex(s string) []int {
 
 	var matches []int
 
-	re.findSubmatch(&alloc, cs, func(match []int) bool {
+	re.findSubmatch(&alloc, cs, Unanchored, func(match []int) bool {
 		matches = append(matches, match...)
 		return true
 	})
@@ -623,12 +730,54 @@ func (re *Regexp) FindStringSubmatchIndex(s string) []int {
 	return res
 }
 
-func (re *Regexp) findSubmatch(alloc *allocation, cs cString, deliver func(match []int) bool) {
+// FindSubmatchIndexAnchored is like FindSubmatchIndex but only reports a
+// match satisfying anchor. With AnchorBoth, the result is non-nil only if the
+// whole of b matches, and unlike wrapping the expression in ^(?:...)$ the
+// submatch numbering is unchanged.
+func (re *Regexp) FindSubmatchIndexAnchored(b []byte, anchor Anchor) []int {
+	alloc := re.abi.startOperation(len(b) + 8*re.numMatches)
+	defer re.abi.endOperation(alloc)
+
+	cs := alloc.newCStringFromBytes(b)
+
+	var matches []int
+
+	re.findSubmatch(&alloc, cs, anchor, func(match []int) bool {
+		matches = append(matches, match...)
+		return true
+	})
+
+	res := matches
+	runtime.KeepAlive(b)
+	return res
+}
+
+// FindStringSubmatchIndexAnchored is like FindStringSubmatchIndex but only
+// reports a match satisfying anchor.
+func (re *Regexp) FindStringSubmatchIndexAnchored(s string, anchor Anchor) []int {
+	alloc := re.abi.startOperation(len(s) + 8*re.numMatches)
+	defer re.abi.endOperation(alloc)
+
+	cs := alloc.newCString(s)
+
+	var matches []int
+
+	re.findSubmatch(&alloc, cs, anchor, func(match []int) bool {
+		matches = append(matches, match...)
+		return true
+	})
+
+	res := matches
+	runtime.KeepAlive(s)
+	return res
+}
+
+func (re *Regexp) findSubmatch(alloc *allocation, cs cString, anchor Anchor, deliver func(match []int) bool) {
 	numGroups := re.numMatches
 	matchArr := alloc.newCStringArray(numGroups)
 	defer matchArr.free()
 
-	if !match(re, cs, matchArr.ptr, uint32(numGroups)) {
+	if !match(re, cs, anchor, matchArr.ptr, uint32(numGroups)) {
 		return
 	}
 
@@ -652,14 +801,27 @@ func (re *Regexp) Longest() {
 	if re.opts.Longest {
 		return
 	}
+	re.enter()
+	defer re.leave()
 
 	// longest is not a mutable option in re2 so we must release and recompile.
 	deleteRE(re.abi, re.ptr)
 
 	cs := alloc.newCString(re.expr)
-	newOpts := re.opts
-	newOpts.Longest = true
-	re.ptr = newRE(re.abi, cs, newOpts)
+	re.opts.Longest = true
+	re.ptr = newRE(re.abi, cs, re.opts)
+	if re.owner != nil {
+		// The owner's finalizer releases the expression, and its options
+		// must describe it.
+		re.owner.ptr = re.ptr
+		re.owner.opts = re.opts
+	}
+}
+
+// Options returns the options re was compiled with, reflecting any later
+// call to Longest.
+func (re *Regexp) Options() CompileOptions {
+	return re.opts
 }
 
 // NumSubexp returns the number of parenthesized subexpressions in this Regexp.
@@ -729,6 +891,8 @@ func (re *Regexp) Split(s string, n int) []string {
 // the empty string. The slice should not be modified.
 func (re *Regexp) SubexpNames() []string {
 	re.groupNamesOnce.Do(func() {
+		re.enter()
+		defer re.leave()
 		re.groupNames = subexpNames(re.abi, re.ptr, re.numMatches)
 	})
 	return re.groupNames
@@ -759,7 +923,7 @@ func (re *Regexp) Match(b []byte) bool {
 	defer re.abi.endOperation(alloc)
 
 	cs := alloc.newCStringFromBytes(b)
-	res := match(re, cs, nilWasmPtr, 0)
+	res := match(re, cs, Unanchored, nilWasmPtr, 0)
 	runtime.KeepAlive(b)
 
 	runtime.KeepAlive(re) // don't allow finalizer to run during method
@@ -774,15 +938,193 @@ func (re *Regexp) MatchString(s string) bool {
 	defer re.abi.endOperation(alloc)
 
 	cs := alloc.newCString(s)
-	res := match(re, cs, nilWasmPtr, 0)
+	res := match(re, cs, Unanchored, nilWasmPtr, 0)
+	runtime.KeepAlive(s)
+
+	runtime.KeepAlive(re) // don't allow finalizer to run during method
+
+	return res
+}
+
+// MatchAnchored reports whether the byte slice b contains a match of the
+// regular expression re satisfying anchor. With AnchorBoth, it reports
+// whether the whole of b matches.
+func (re *Regexp) MatchAnchored(b []byte, anchor Anchor) bool {
+	alloc := re.abi.startOperation(len(b))
+	defer re.abi.endOperation(alloc)
+
+	cs := alloc.newCStringFromBytes(b)
+	res := match(re, cs, anchor, nilWasmPtr, 0)
+	runtime.KeepAlive(b)
+
+	runtime.KeepAlive(re) // don't allow finalizer to run during method
+
+	return res
+}
+
+// MatchStringAnchored reports whether the string s contains a match of the
+// regular expression re satisfying anchor.
+func (re *Regexp) MatchStringAnchored(s string, anchor Anchor) bool {
+	alloc := re.abi.startOperation(len(s))
+	defer re.abi.endOperation(alloc)
+
+	cs := alloc.newCString(s)
+	res := match(re, cs, anchor, nilWasmPtr, 0)
+	runtime.KeepAlive(s)
+
+	runtime.KeepAlive(re) // don't allow finalizer to run during method
+
+	return res
+}
+
+// MatchRange reports whether b[start:end] contains any match of the regular
+// expression re. Unlike slicing b first, ^, $ and \b see the bytes of b
+// outside the range, so for example ^ does not match at start unless start
+// is 0. MatchRange panics if start and end are not a valid range of b.
+func (re *Regexp) MatchRange(b []byte, start, end int) bool {
+	checkRange(start, end, len(b))
+
+	alloc := re.abi.startOperation(len(b))
+	defer re.abi.endOperation(alloc)
+
+	cs := alloc.newCStringFromBytes(b)
+	res := matchRange(re, cs, start, end, Unanchored, nilWasmPtr, 0)
+	runtime.KeepAlive(b)
+
+	runtime.KeepAlive(re) // don't allow finalizer to run during method
+
+	return res
+}
+
+// MatchStringRange is like MatchRange but searches s[start:end].
+func (re *Regexp) MatchStringRange(s string, start, end int) bool {
+	checkRange(start, end, len(s))
+
+	alloc := re.abi.startOperation(len(s))
+	defer re.abi.endOperation(alloc)
+
+	cs := alloc.newCString(s)
+	res := matchRange(re, cs, start, end, Unanchored, nilWasmPtr, 0)
+	runtime.KeepAlive(s)
+
+	runtime.KeepAlive(re) // don't allow finalizer to run during method
+
+	return res
+}
+
+// FindIndexInRange is like FindIndex but only searches b[start:end], with
+// the surrounding bytes of b providing context as described in MatchRange.
+// The returned indices are relative to b, not to start.
+func (re *Regexp) FindIndexInRange(b []byte, start, end int) (loc []int) {
+	checkRange(start, end, len(b))
+
+	alloc := re.abi.startOperation(len(b) + 8)
+	defer re.abi.endOperation(alloc)
+	cs := alloc.newCStringFromBytes(b)
+
+	res := re.findInRange(&alloc, cs, start, end)
+	runtime.KeepAlive(b)
+	return res
+}
+
+// FindStringIndexInRange is like FindIndexInRange but searches s[start:end].
+func (re *Regexp) FindStringIndexInRange(s string, start, end int) (loc []int) {
+	checkRange(start, end, len(s))
+
+	alloc := re.abi.startOperation(len(s) + 8)
+	defer re.abi.endOperation(alloc)
+	cs := alloc.newCString(s)
+
+	res := re.findInRange(&alloc, cs, start, end)
 	runtime.KeepAlive(s)
+	return res
+}
+
+func (re *Regexp) findInRange(alloc *allocation, cs cString, start, end int) []int {
+	matchArr := alloc.newCStringArray(1)
+	defer matchArr.free()
+
+	if !matchRange(re, cs, start, end, Unanchored, matchArr.ptr, 1) {
+		return nil
+	}
+
+	m := readMatch(alloc, cs, matchArr.ptr, nil)
+	runtime.KeepAlive(matchArr)
+
+	runtime.KeepAlive(re) // don't allow finalizer to run during method
+
+	return m
+}
+
+func checkRange(start, end, length int) {
+	if start < 0 || end < start || end > length {
+		panic(fmt.Sprintf("regexp: range [%d:%d] out of bounds with length %d", start, end, length))
+	}
+}
 
+// ProgramSize returns the size of the compiled program, a measure of the
+// cost of the expression. Larger programs are more expensive to match. It
+// returns -1 if the size cannot be determined.
+func (re *Regexp) ProgramSize() int {
+	re.enter()
+	defer re.leave()
+	res := programSize(re.abi, re.ptr)
 	runtime.KeepAlive(re) // don't allow finalizer to run during method
+	return res
+}
 
+// ReverseProgramSize returns the size of the compiled program for matching
+// in reverse, used to find the start of matches. It is compiled on first use,
+// so calling it has a cost for expressions never matched that way. It returns
+// -1 if the size cannot be determined.
+func (re *Regexp) ReverseProgramSize() int {
+	re.enter()
+	defer re.leave()
+	res := reverseProgramSize(re.abi, re.ptr)
+	runtime.KeepAlive(re) // don't allow finalizer to run during method
 	return res
 }
 
+// Close frees the memory held by the compiled expression without waiting for
+// re to be garbage collected, which matters with the cgo build where it is not
+// visible to the garbage collector. Close waits for methods already using the
+// compiled expression to return, and methods matching with re panic once it
+// is closed. Calling Close more than once has no effect.
+func (re *Regexp) Close() {
+	re.release()
+}
+
+// enter panics if re was closed, and otherwise keeps Close from freeing the
+// compiled expression until leave is called, while it is used.
+func (re *Regexp) enter() {
+	r := re.closer()
+	r.closeMu.RLock()
+	if atomic.LoadUint32(&r.released) != 0 {
+		r.closeMu.RUnlock()
+		panic("re2: use of closed Regexp")
+	}
+}
+
+func (re *Regexp) leave() {
+	re.closer().closeMu.RUnlock()
+}
+
+// closer returns the Regexp owning the compiled expression of re.
+func (re *Regexp) closer() *Regexp {
+	if re.owner != nil {
+		return re.owner
+	}
+	return re
+}
+
 func (re *Regexp) release() {
+	if re.owner != nil {
+		re.owner.release()
+		return
+	}
+	// Wait for methods using the compiled expression to return.
+	re.closeMu.Lock()
+	defer re.closeMu.Unlock()
 	if !atomic.CompareAndSwapUint32(&re.released, 0, 1) {
 		return
 	}
@@ -797,10 +1139,16 @@ func Release(re *Regexp) {
 // with the replacement text repl. Inside repl, $ signs are interpreted as
 // in Expand, so for instance $1 represents the text of the first submatch.
 func (re *Regexp) ReplaceAll(src, repl []byte) []byte {
-	alloc := re.abi.startOperation(len(src) + 8*re.numMatches + 8)
+	rewrite, native := re.nativeRewrite(string(repl), false)
+	alloc := re.abi.startOperation(len(src) + 8*re.numMatches + 8 + len(rewrite) + 16)
 	defer re.abi.endOperation(alloc)
 
 	cs := alloc.newCStringFromBytes(src)
+	if native {
+		if b, ok := re.globalReplace(&alloc, cs, rewrite); ok {
+			return b
+		}
+	}
 
 	n := 2
 	if bytes.IndexByte(repl, '$') >= 0 {
@@ -808,7 +1156,7 @@ func (re *Regexp) ReplaceAll(src, repl []byte) []byte {
 	}
 
 	srepl := ""
-	b := re.replaceAll(&alloc, src, "", cs, n, func(dst []byte, m []int) []byte {
+	b := re.replaceAll(&alloc, src, "", cs, n, -1, func(dst []byte, m []int) []byte {
 		if len(srepl) != len(repl) {
 			srepl = string(repl)
 		}
@@ -827,7 +1175,7 @@ func (re *Regexp) ReplaceAllFunc(src []byte, repl func([]byte) []byte) []byte {
 
 	cs := alloc.newCStringFromBytes(src)
 
-	return re.replaceAll(&alloc, src, "", cs, 2, func(dst []byte, m []int) []byte {
+	return re.replaceAll(&alloc, src, "", cs, 2, -1, func(dst []byte, m []int) []byte {
 		return append(dst, repl(src[m[0]:m[1]])...)
 	})
 }
@@ -836,12 +1184,18 @@ func (re *Regexp) ReplaceAllFunc(src []byte, repl func([]byte) []byte) []byte {
 // with the replacement bytes repl. The replacement repl is substituted directly,
 // without using Expand.
 func (re *Regexp) ReplaceAllLiteral(src, repl []byte) []byte {
-	alloc := re.abi.startOperation(len(src) + 8*re.numMatches + 8)
+	rewrite, native := re.nativeRewrite(string(repl), true)
+	alloc := re.abi.startOperation(len(src) + 8*re.numMatches + 8 + len(rewrite) + 16)
 	defer re.abi.endOperation(alloc)
 
 	cs := alloc.newCStringFromBytes(src)
+	if native {
+		if b, ok := re.globalReplace(&alloc, cs, rewrite); ok {
+			return b
+		}
+	}
 
-	return re.replaceAll(&alloc, src, "", cs, 2, func(dst []byte, _ []int) []byte {
+	return re.replaceAll(&alloc, src, "", cs, 2, -1, func(dst []byte, _ []int) []byte {
 		return append(dst, repl...)
 	})
 }
@@ -850,12 +1204,18 @@ func (re *Regexp) ReplaceAllLiteral(src, repl []byte) []byte {
 // with the replacement string repl. The replacement repl is substituted directly,
 // without using Expand.
 func (re *Regexp) ReplaceAllLiteralString(src, repl string) string {
-	alloc := re.abi.startOperation(len(src) + 8*re.numMatches + 8)
+	rewrite, native := re.nativeRewrite(repl, true)
+	alloc := re.abi.startOperation(len(src) + 8*re.numMatches + 8 + len(rewrite) + 16)
 	defer re.abi.endOperation(alloc)
 
 	cs := alloc.newCString(src)
+	if native {
+		if b, ok := re.globalReplace(&alloc, cs, rewrite); ok {
+			return string(b)
+		}
+	}
 
-	b := re.replaceAll(&alloc, nil, src, cs, 2, func(dst []byte, _ []int) []byte {
+	b := re.replaceAll(&alloc, nil, src, cs, 2, -1, func(dst []byte, _ []int) []byte {
 		return append(dst, repl...)
 	})
 
@@ -866,17 +1226,23 @@ func (re *Regexp) ReplaceAllLiteralString(src, repl string) string {
 // with the replacement string repl. Inside repl, $ signs are interpreted as
 // in Expand, so for instance $1 represents the text of the first submatch.
 func (re *Regexp) ReplaceAllString(src, repl string) string {
-	alloc := re.abi.startOperation(len(src) + 8*re.numMatches + 8)
+	rewrite, native := re.nativeRewrite(repl, false)
+	alloc := re.abi.startOperation(len(src) + 8*re.numMatches + 8 + len(rewrite) + 16)
 	defer re.abi.endOperation(alloc)
 
 	cs := alloc.newCString(src)
+	if native {
+		if b, ok := re.globalReplace(&alloc, cs, rewrite); ok {
+			return string(b)
+		}
+	}
 
 	n := 2
 	if strings.Contains(repl, "$") {
 		n = re.numMatches
 	}
 
-	b := re.replaceAll(&alloc, nil, src, cs, n, func(dst []byte, m []int) []byte {
+	b := re.replaceAll(&alloc, nil, src, cs, n, -1, func(dst []byte, m []int) []byte {
 		return re.expand(dst, repl, nil, src, m)
 	})
 
@@ -893,18 +1259,94 @@ func (re *Regexp) ReplaceAllStringFunc(src string, repl func(string) string) str
 
 	cs := alloc.newCString(src)
 
-	b := re.replaceAll(&alloc, nil, src, cs, 2, func(dst []byte, m []int) []byte {
+	b := re.replaceAll(&alloc, nil, src, cs, 2, -1, func(dst []byte, m []int) []byte {
 		return append(dst, repl(src[m[0]:m[1]])...)
 	})
 
 	return string(b)
 }
 
-func (re *Regexp) replaceAll(alloc *allocation, bsrc []byte, src string, cs cString, nmatch int, repl func(dst []byte, m []int) []byte) []byte {
+// ReplaceAllSubmatchFunc returns a copy of src in which all matches of the
+// Regexp have been replaced by the bytes repl appends to dst. repl is passed
+// all of src and the locations of the match and its submatches within it, as
+// returned by FindSubmatchIndex, so the replacement can depend on the
+// submatches and the text around the match.
+func (re *Regexp) ReplaceAllSubmatchFunc(src []byte, repl func(dst []byte, src []byte, match []int) []byte) []byte {
+	alloc := re.abi.startOperation(len(src) + 8*re.numMatches + 8)
+	defer re.abi.endOperation(alloc)
+
+	cs := alloc.newCStringFromBytes(src)
+
+	return re.replaceAll(&alloc, src, "", cs, re.numMatches, -1, func(dst []byte, m []int) []byte {
+		return repl(dst, src, m)
+	})
+}
+
+// ReplaceAllStringSubmatchFunc is like ReplaceAllSubmatchFunc but operates on
+// a string.
+func (re *Regexp) ReplaceAllStringSubmatchFunc(src string, repl func(dst []byte, src string, match []int) []byte) string {
+	alloc := re.abi.startOperation(len(src) + 8*re.numMatches + 8)
+	defer re.abi.endOperation(alloc)
+
+	cs := alloc.newCString(src)
+
+	b := re.replaceAll(&alloc, nil, src, cs, re.numMatches, -1, func(dst []byte, m []int) []byte {
+		return repl(dst, src, m)
+	})
+
+	return string(b)
+}
+
+// ReplaceN is like ReplaceAll but replaces at most the first n matches. If
+// n < 0, all matches are replaced.
+func (re *Regexp) ReplaceN(src, repl []byte, n int) []byte {
+	alloc := re.abi.startOperation(len(src) + 8*re.numMatches + 8)
+	defer re.abi.endOperation(alloc)
+
+	cs := alloc.newCStringFromBytes(src)
+
+	nmatch := 2
+	if bytes.IndexByte(repl, '$') >= 0 {
+		nmatch = re.numMatches
+	}
+
+	srepl := string(repl)
+	return re.replaceAll(&alloc, src, "", cs, nmatch, n, func(dst []byte, m []int) []byte {
+		return re.expand(dst, srepl, src, "", m)
+	})
+}
+
+// ReplaceStringN is like ReplaceAllString but replaces at most the first n
+// matches. If n < 0, all matches are replaced.
+func (re *Regexp) ReplaceStringN(src, repl string, n int) string {
+	alloc := re.abi.startOperation(len(src) + 8*re.numMatches + 8)
+	defer re.abi.endOperation(alloc)
+
+	cs := alloc.newCString(src)
+
+	nmatch := 2
+	if strings.Contains(repl, "$") {
+		nmatch = re.numMatches
+	}
+
+	b := re.replaceAll(&alloc, nil, src, cs, nmatch, n, func(dst []byte, m []int) []byte {
+		return re.expand(dst, repl, nil, src, m)
+	})
+
+	return string(b)
+}
+
+// replaceAll replaces at most n matches, or all of them if n < 0.
+func (re *Regexp) replaceAll(alloc *allocation, bsrc []byte, src string, cs cString, nmatch int, n int, repl func(dst []byte, m []int) []byte) []byte {
 	lastMatchEnd := 0
 	var buf []byte
 
-	re.findAllSubmatch(alloc, bsrc, src, cs, nmatch, -1, func(a []int) {
+	count := 0
+	re.findAllSubmatch(alloc, bsrc, src, cs, nmatch, -1, func(a []int) bool {
+		if count == n {
+			return false
+		}
+
 		// Copy the unmatched characters before this match.
 		if bsrc != nil {
 			buf = append(buf, bsrc[lastMatchEnd:a[0]]...)
@@ -914,8 +1356,10 @@ func (re *Regexp) replaceAll(alloc *allocation, bsrc []byte, src string, cs cStr
 
 		if a[1] > lastMatchEnd || a[0] == 0 {
 			buf = repl(buf, a)
+			count++
 		}
 		lastMatchEnd = a[1]
+		return count != n
 	})
 
 	if bsrc != nil {
@@ -932,6 +1376,102 @@ func (re *Regexp) String() string {
 	return re.expr
 }
 
+// LiteralPrefix returns a literal string that must begin any match
+// of the regular expression re. It returns the boolean true if the
+// literal string comprises the entire regular expression.
+//
+// The prefix is found by analyzing the expression with regexp/syntax. If the
+// expression uses syntax only supported by re2, or was compiled with options
+// that can't be expressed as flags, the returned prefix is empty.
+func (re *Regexp) LiteralPrefix() (prefix string, complete bool) {
+	re.literalPrefixOnce.Do(func() {
+		re.literalPrefix, re.literalPrefixComplete = literalPrefix(re.expr, re.opts)
+	})
+	return re.literalPrefix, re.literalPrefixComplete
+}
+
+func literalPrefix(expr string, opts CompileOptions) (string, bool) {
+	if opts.Latin1 || opts.NeverNL {
+		return "", false
+	}
+	if opts.Literal {
+		return expr, true
+	}
+
+	var flags string
+	if opts.CaseInsensitive {
+		flags += "i"
+	}
+	if opts.DotNL {
+		flags += "s"
+	}
+	if flags != "" {
+		expr = "(?" + flags + ")" + expr
+	}
+
+	var sre *regexp.Regexp
+	var err error
+	if opts.Posix {
+		sre, err = regexp.CompilePOSIX(expr)
+	} else {
+		sre, err = regexp.Compile(expr)
+	}
+	if err != nil {
+		return "", false
+	}
+	return sre.LiteralPrefix()
+}
+
+// MarshalText implements encoding.TextMarshaler. The output
+// matches that of calling the String method.
+//
+// Note that the output is lossy in some cases: This method does not indicate
+// POSIX regular expressions (i.e. those compiled by calling CompilePOSIX), or
+// those for which the Longest method has been called.
+func (re *Regexp) MarshalText() ([]byte, error) {
+	return []byte(re.String()), nil
+}
+
+// AppendText implements encoding.TextAppender. The output
+// matches that of calling the String method.
+//
+// Note that the output is lossy in some cases: This method does not indicate
+// POSIX regular expressions (i.e. those compiled by calling CompilePOSIX), or
+// those for which the Longest method has been called.
+func (re *Regexp) AppendText(b []byte) ([]byte, error) {
+	return append(b, re.String()...), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler by calling
+// Compile on the encoded value.
+func (re *Regexp) UnmarshalText(text []byte) error {
+	newRE, err := Compile(string(text), CompileOptions{})
+	if err != nil {
+		return err
+	}
+	if re.ptr != nilWasmPtr {
+		re.release()
+	}
+
+	// re may not be the start of an allocation, so it can't have a finalizer.
+	// Instead it keeps newRE, and its finalizer, alive.
+	re.ptr = newRE.ptr
+	re.opts = newRE.opts
+	re.expr = newRE.expr
+	re.numMatches = newRE.numMatches
+	re.groupNames = nil
+	re.groupNamesOnce = sync.Once{}
+	re.literalPrefix = ""
+	re.literalPrefixComplete = false
+	re.literalPrefixOnce = sync.Once{}
+	re.partial = nil
+	re.partialOnce = sync.Once{}
+	re.abi = newRE.abi
+	re.owner = newRE
+	atomic.StoreUint32(&re.released, 0)
+	return nil
+}
+
 func subexpNames(abi *libre2ABI, rePtr wasmPtr, numMatches int) []string {
 	res := make([]string, numMatches)
 
@@ -3,6 +3,7 @@
 package internal
 
 import (
+	"runtime"
 	"unsafe"
 
 	"github.com/wasilibs/go-re2/internal/cre2"
@@ -25,10 +26,9 @@ func (*libre2ABI) startOperation(int) allocation {
 func (*libre2ABI) endOperation(allocation) {
 }
 
-func newRE(_ *libre2ABI, pattern cString, opts CompileOptions) wasmPtr {
+func newOpt(opts CompileOptions) unsafe.Pointer {
 	opt := cre2.NewOpt()
-	defer cre2.DeleteOpt(opt)
-	cre2.OptSetMaxMem(opt, maxSize)
+	cre2.OptSetMaxMem(opt, int(opts.maxMem()))
 	cre2.OptSetLogErrors(opt, false)
 	if opts.Longest {
 		cre2.OptSetLongestMatch(opt, true)
@@ -42,6 +42,38 @@ func newRE(_ *libre2ABI, pattern cString, opts CompileOptions) wasmPtr {
 	if opts.Latin1 {
 		cre2.OptSetLatin1Encoding(opt)
 	}
+	if opts.Literal {
+		cre2.OptSetLiteral(opt, true)
+	}
+	if opts.NeverNL {
+		cre2.OptSetNeverNL(opt, true)
+	}
+	if opts.DotNL {
+		cre2.OptSetDotNL(opt, true)
+	}
+	if opts.NeverCapture {
+		cre2.OptSetNeverCapture(opt, true)
+	}
+	if opts.PerlClasses {
+		cre2.OptSetPerlClasses(opt, true)
+	}
+	if opts.WordBoundary {
+		cre2.OptSetWordBoundary(opt, true)
+	}
+	if opts.OneLine {
+		cre2.OptSetOneLine(opt, true)
+	}
+	return opt
+}
+
+// checkOptions always succeeds as every option can be set with cgo.
+func checkOptions(_ *libre2ABI, _ CompileOptions) error {
+	return nil
+}
+
+func newRE(_ *libre2ABI, pattern cString, opts CompileOptions) wasmPtr {
+	opt := newOpt(opts)
+	defer cre2.DeleteOpt(opt)
 	return wasmPtr(cre2.New(pattern.ptr, pattern.length, opt))
 }
 
@@ -59,6 +91,138 @@ func numCapturingGroups(_ *libre2ABI, rePtr wasmPtr) int {
 	return cre2.NumCapturingGroups(unsafe.Pointer(rePtr))
 }
 
+func programSize(_ *libre2ABI, rePtr wasmPtr) int {
+	return cre2.ProgramSize(unsafe.Pointer(rePtr))
+}
+
+func reverseProgramSize(_ *libre2ABI, rePtr wasmPtr) int {
+	return cre2.ReverseProgramSize(unsafe.Pointer(rePtr))
+}
+
+// PossibleMatchRange returns strings min and max such that any string s
+// matched by the expression anchored at its start satisfies min <= s and
+// s <= max, useful to turn the expression into a range scan of sorted keys.
+// The strings are at most maxLen bytes long. Only the first copy of an
+// infinitely repeated element, followed by * or +, is considered. ok is false
+// if no useful range can be determined.
+//
+// PossibleMatchRange is only available with the cgo build, as the Wasm
+// library does not export cre2_possible_match_range.
+func (re *Regexp) PossibleMatchRange(maxLen int) (min, max string, ok bool) {
+	min, max, ok = possibleMatchRange(re, maxLen)
+	runtime.KeepAlive(re) // don't allow finalizer to run during method
+	return min, max, ok
+}
+
+func possibleMatchRange(re *Regexp, maxLen int) (string, string, bool) {
+	re.enter()
+	defer re.leave()
+	var alloc allocation
+	rangeArr := alloc.newCStringArray(2)
+	defer rangeArr.free()
+
+	minStr := (*cString)(rangeArr.ptr)
+	maxStr := (*cString)(unsafe.Add(unsafe.Pointer(rangeArr.ptr), unsafe.Sizeof(cString{})))
+	if cre2.PossibleMatchRange(unsafe.Pointer(re.ptr), unsafe.Pointer(minStr), unsafe.Pointer(maxStr), maxLen) != 1 {
+		return "", "", false
+	}
+	defer cre2.Free(minStr.ptr)
+	defer cre2.Free(maxStr.ptr)
+
+	// length is a C int, only the low bytes of the zeroed field are written.
+	minLen := int(int32(minStr.length))
+	maxLen = int(int32(maxStr.length))
+	return cre2.CopyCStringN(minStr.ptr, minLen), cre2.CopyCStringN(maxStr.ptr, maxLen), true
+}
+
+func hasRewrite(_ *libre2ABI) bool {
+	return true
+}
+
+func extractRewrite(re *Regexp, text cString, rewrite cString) (string, bool) {
+	re.enter()
+	defer re.leave()
+	// As with globalReplace, the strings are copied to C memory.
+	size := int(unsafe.Sizeof(cString{}))
+	buf := cre2.Malloc(3*size + text.length + rewrite.length)
+	defer cre2.Free(buf)
+	textStr := (*cString)(buf)
+	rewriteStr := (*cString)(unsafe.Add(buf, size))
+	targetStr := (*cString)(unsafe.Add(buf, 2*size))
+	textData := unsafe.Add(buf, 3*size)
+	rewriteData := unsafe.Add(textData, text.length)
+	copy(unsafe.Slice((*byte)(textData), text.length), unsafe.Slice((*byte)(text.ptr), text.length))
+	copy(unsafe.Slice((*byte)(rewriteData), rewrite.length), unsafe.Slice((*byte)(rewrite.ptr), rewrite.length))
+	*textStr = cString{ptr: textData, length: text.length}
+	*rewriteStr = cString{ptr: rewriteData, length: rewrite.length}
+	*targetStr = cString{}
+
+	res := cre2.Extract(unsafe.Pointer(re.ptr), unsafe.Pointer(textStr), unsafe.Pointer(rewriteStr), unsafe.Pointer(targetStr))
+	if res < 0 {
+		return "", false
+	}
+	defer cre2.Free(targetStr.ptr)
+	if res == 0 {
+		return "", false
+	}
+
+	// length is a C int, only the low bytes of the zeroed field are written.
+	return cre2.CopyCStringN(targetStr.ptr, int(int32(targetStr.length))), true
+}
+
+func checkRewrite(re *Regexp, rewrite cString) (string, bool) {
+	re.enter()
+	defer re.leave()
+	size := int(unsafe.Sizeof(cString{}))
+	buf := cre2.Malloc(2*size + rewrite.length)
+	defer cre2.Free(buf)
+	rewriteStr := (*cString)(buf)
+	errStr := (*cString)(unsafe.Add(buf, size))
+	rewriteData := unsafe.Add(buf, 2*size)
+	copy(unsafe.Slice((*byte)(rewriteData), rewrite.length), unsafe.Slice((*byte)(rewrite.ptr), rewrite.length))
+	*rewriteStr = cString{ptr: rewriteData, length: rewrite.length}
+	*errStr = cString{}
+
+	switch cre2.CheckRewriteString(unsafe.Pointer(re.ptr), unsafe.Pointer(rewriteStr), unsafe.Pointer(errStr)) {
+	case 1:
+		return "", true
+	case 0:
+		defer cre2.Free(errStr.ptr)
+		return cre2.CopyCStringN(errStr.ptr, int(int32(errStr.length))), false
+	}
+	return "out of memory checking rewrite", false
+}
+
+func hasGlobalReplace(_ *libre2ABI) bool {
+	return true
+}
+
+func globalReplace(re *Regexp, _ *allocation, text cString, rewrite cString) ([]byte, bool) {
+	re.enter()
+	defer re.leave()
+	// The strings are passed in structs, which may not hold pointers to Go
+	// memory, so copy them to C memory first.
+	buf := cre2.Malloc(2*int(unsafe.Sizeof(cString{})) + text.length + rewrite.length)
+	defer cre2.Free(buf)
+	textStr := (*cString)(buf)
+	rewriteStr := (*cString)(unsafe.Add(buf, unsafe.Sizeof(cString{})))
+	textData := unsafe.Add(buf, 2*unsafe.Sizeof(cString{}))
+	rewriteData := unsafe.Add(textData, text.length)
+	copy(unsafe.Slice((*byte)(textData), text.length), unsafe.Slice((*byte)(text.ptr), text.length))
+	copy(unsafe.Slice((*byte)(rewriteData), rewrite.length), unsafe.Slice((*byte)(rewrite.ptr), rewrite.length))
+	*textStr = cString{ptr: textData, length: text.length}
+	*rewriteStr = cString{ptr: rewriteData, length: rewrite.length}
+
+	if cre2.GlobalReplace(unsafe.Pointer(re.ptr), unsafe.Pointer(textStr), unsafe.Pointer(rewriteStr)) < 0 {
+		return nil, false
+	}
+	defer cre2.Free(textStr.ptr)
+
+	// length is a C int, only the low bytes of the field are written.
+	resLen := int(int32(textStr.length))
+	return append([]byte(nil), unsafe.Slice((*byte)(textStr.ptr), resLen)...), true
+}
+
 func deleteRE(_ *libre2ABI, rePtr wasmPtr) {
 	cre2.Delete(unsafe.Pointer(rePtr))
 }
@@ -67,16 +231,36 @@ func release(re *Regexp) {
 	deleteRE(re.abi, re.ptr)
 }
 
-func match(re *Regexp, s cString, matchesPtr wasmPtr, nMatches uint32) bool {
+func match(re *Regexp, s cString, anchor Anchor, matchesPtr wasmPtr, nMatches uint32) bool {
+	re.enter()
+	defer re.leave()
 	return cre2.Match(unsafe.Pointer(re.ptr), s.ptr,
-		s.length, 0, s.length, 0, unsafe.Pointer(matchesPtr), int(nMatches))
+		s.length, 0, s.length, anchor.cre2(), unsafe.Pointer(matchesPtr), int(nMatches))
+}
+
+func matchBatch(re *Regexp, css []cString, anchor Anchor, matchesPtrs []wasmPtr, nMatches uint32, matched []bool) {
+	re.enter()
+	defer re.leave()
+	for i, s := range css {
+		matched[i] = cre2.Match(unsafe.Pointer(re.ptr), s.ptr,
+			s.length, 0, s.length, anchor.cre2(), unsafe.Pointer(matchesPtrs[i]), int(nMatches))
+	}
 }
 
 func matchFrom(re *Regexp, s cString, startPos int, matchesPtr wasmPtr, nMatches uint32) bool {
+	re.enter()
+	defer re.leave()
 	return cre2.Match(unsafe.Pointer(re.ptr), s.ptr,
 		s.length, startPos, s.length, 0, unsafe.Pointer(matchesPtr), int(nMatches))
 }
 
+func matchRange(re *Regexp, s cString, startPos int, endPos int, anchor Anchor, matchesPtr wasmPtr, nMatches uint32) bool {
+	re.enter()
+	defer re.leave()
+	return cre2.Match(unsafe.Pointer(re.ptr), s.ptr,
+		s.length, startPos, endPos, anchor.cre2(), unsafe.Pointer(matchesPtr), int(nMatches))
+}
+
 type allocation struct{}
 
 func (*allocation) newCString(s string) cString {
@@ -120,6 +304,11 @@ type cString struct {
 	length int
 }
 
+// slice returns the part of cs from start to end, which must not be empty.
+func (cs cString) slice(start, end int) cString {
+	return cString{ptr: unsafe.Add(cs.ptr, start), length: end - start}
+}
+
 type cStringArray struct {
 	ptr wasmPtr
 }
@@ -168,24 +357,10 @@ func readMatches(alloc *allocation, cs cString, matchesPtr wasmPtr, n int, deliv
 	}
 }
 
-func newSet(_ *libre2ABI, opts CompileOptions) wasmPtr {
-	opt := cre2.NewOpt()
+func newSet(_ *libre2ABI, opts CompileOptions, anchor Anchor) wasmPtr {
+	opt := newOpt(opts)
 	defer cre2.DeleteOpt(opt)
-	cre2.OptSetMaxMem(opt, maxSize)
-	cre2.OptSetLogErrors(opt, false)
-	if opts.Longest {
-		cre2.OptSetLongestMatch(opt, true)
-	}
-	if opts.Posix {
-		cre2.OptSetPosixSyntax(opt, true)
-	}
-	if opts.CaseInsensitive {
-		cre2.OptSetCaseSensitive(opt, false)
-	}
-	if opts.Latin1 {
-		cre2.OptSetLatin1Encoding(opt)
-	}
-	return wasmPtr(cre2.NewSet(opt, 0))
+	return wasmPtr(cre2.NewSet(opt, anchor.cre2()))
 }
 
 func setAdd(set *Set, s cString) string {
@@ -206,9 +381,25 @@ func setCompile(set *Set) int32 {
 }
 
 func setMatch(set *Set, cs cString, matchedPtr wasmPtr, nMatch int) int {
+	set.enter()
+	defer set.leave()
 	return cre2.SetMatch(unsafe.Pointer(set.ptr), cs.ptr, cs.length, unsafe.Pointer(matchedPtr), nMatch)
 }
 
+func setMatchBatch(set *Set, css []cString, matchedPtrs []wasmPtr, nMatch int, counts []int) {
+	set.enter()
+	defer set.leave()
+	for i, cs := range css {
+		counts[i] = cre2.SetMatch(unsafe.Pointer(set.ptr), cs.ptr, cs.length, unsafe.Pointer(matchedPtrs[i]), nMatch)
+	}
+}
+
+func setMatchChecked(set *Set, cs cString, matchedPtr wasmPtr, nMatch int) int {
+	set.enter()
+	defer set.leave()
+	return cre2.SetMatchChecked(unsafe.Pointer(set.ptr), cs.ptr, cs.length, unsafe.Pointer(matchedPtr), nMatch)
+}
+
 func deleteSet(_ *libre2ABI, setPtr wasmPtr) {
 	cre2.SetDelete(unsafe.Pointer(setPtr))
 }
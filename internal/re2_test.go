@@ -0,0 +1,71 @@
+package internal
+
+import (
+	"sync/atomic"
+	"testing"
+)
+
+func TestUnmarshalTextLongest(t *testing.T) {
+	var re Regexp
+	if err := re.UnmarshalText([]byte(`a+?`)); err != nil {
+		t.Fatal(err)
+	}
+	re.Longest()
+
+	if re.owner.ptr != re.ptr {
+		t.Error("owner does not hold the recompiled expression")
+	}
+	if re.owner.opts != re.opts {
+		t.Errorf("owner options = %+v, want %+v", re.owner.opts, re.opts)
+	}
+	if got := re.FindString("aaa"); got != "aaa" {
+		t.Errorf("FindString() = %q, want %q", got, "aaa")
+	}
+}
+
+// BenchmarkEnterLeave compares the lock taken by every method using the
+// compiled expression, so it is not freed by a concurrent Close, with the
+// shortest match and with the two atomic operations any count of the methods
+// in progress would need.
+func BenchmarkEnterLeave(b *testing.B) {
+	re, err := Compile(`\d`, CompileOptions{})
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer re.Close()
+	input := "abc7def"
+
+	b.Run("lock", func(b *testing.B) {
+		for range b.N {
+			re.enter()
+			re.leave()
+		}
+	})
+	b.Run("lock/parallel", func(b *testing.B) {
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				re.enter()
+				re.leave()
+			}
+		})
+	})
+	b.Run("atomic", func(b *testing.B) {
+		var n atomic.Int32
+		for range b.N {
+			n.Add(1)
+			n.Add(-1)
+		}
+	})
+	b.Run("match", func(b *testing.B) {
+		for range b.N {
+			re.MatchString(input)
+		}
+	})
+	b.Run("match/parallel", func(b *testing.B) {
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				re.MatchString(input)
+			}
+		})
+	})
+}
@@ -135,20 +135,13 @@ func withModuleNoResult(fn func(*wasm2go.Module)) {
 	fn(modH.mod)
 }
 
-func newRE(abi *libre2ABI, pattern cString, opts CompileOptions) wasmPtr {
-	_ = abi
+func newOpt(opts CompileOptions) uint32 {
 	optPtr := uint32(withModule(func(m *wasm2go.Module) uint64 {
 		return uint64(m.Xcre2_opt_new())
 	}))
 
-	defer func() {
-		withModuleNoResult(func(m *wasm2go.Module) {
-			m.Xcre2_opt_delete(int32(optPtr))
-		})
-	}()
-
 	withModuleNoResult(func(m *wasm2go.Module) {
-		m.Xcre2_opt_set_max_mem(int32(optPtr), int64(maxSize))
+		m.Xcre2_opt_set_max_mem(int32(optPtr), opts.maxMem())
 	})
 
 	if opts.Longest {
@@ -171,6 +164,64 @@ func newRE(abi *libre2ABI, pattern cString, opts CompileOptions) wasmPtr {
 			m.Xcre2_opt_set_latin1_encoding(int32(optPtr))
 		})
 	}
+	for _, f := range optFlagsToSet(opts) {
+		// Checked by checkOptions before compiling.
+		withModuleNoResult(func(m *wasm2go.Module) {
+			setOptFlag(m, optPtr, f)
+		})
+	}
+
+	return optPtr
+}
+
+// optSettersModule is implemented by a build of the Wasm library exporting
+// setters for all boolean options.
+type optSettersModule interface {
+	Xcre2_opt_set_literal(v0, v1 int32)
+	Xcre2_opt_set_never_nl(v0, v1 int32)
+	Xcre2_opt_set_dot_nl(v0, v1 int32)
+	Xcre2_opt_set_never_capture(v0, v1 int32)
+	Xcre2_opt_set_perl_classes(v0, v1 int32)
+	Xcre2_opt_set_word_boundary(v0, v1 int32)
+	Xcre2_opt_set_one_line(v0, v1 int32)
+}
+
+func hasOptSetter(_ *libre2ABI, _ optFlag) bool {
+	_, ok := any((*wasm2go.Module)(nil)).(optSettersModule)
+	return ok
+}
+
+func setOptFlag(m *wasm2go.Module, optPtr uint32, f optFlag) {
+	sm := any(m).(optSettersModule)
+	opt := int32(optPtr)
+	switch f {
+	case optFlagLiteral:
+		sm.Xcre2_opt_set_literal(opt, 1)
+	case optFlagNeverNL:
+		sm.Xcre2_opt_set_never_nl(opt, 1)
+	case optFlagDotNL:
+		sm.Xcre2_opt_set_dot_nl(opt, 1)
+	case optFlagNeverCapture:
+		sm.Xcre2_opt_set_never_capture(opt, 1)
+	case optFlagPerlClasses:
+		sm.Xcre2_opt_set_perl_classes(opt, 1)
+	case optFlagWordBoundary:
+		sm.Xcre2_opt_set_word_boundary(opt, 1)
+	case optFlagOneLine:
+		sm.Xcre2_opt_set_one_line(opt, 1)
+	}
+}
+
+func deleteOpt(optPtr uint32) {
+	withModuleNoResult(func(m *wasm2go.Module) {
+		m.Xcre2_opt_delete(int32(optPtr))
+	})
+}
+
+func newRE(abi *libre2ABI, pattern cString, opts CompileOptions) wasmPtr {
+	_ = abi
+	optPtr := newOpt(opts)
+	defer deleteOpt(optPtr)
 
 	res := withModule(func(m *wasm2go.Module) uint64 {
 		return uint64(m.Xcre2_new(int32(pattern.ptr), int32(pattern.length), int32(optPtr)))
@@ -203,6 +254,61 @@ func numCapturingGroups(abi *libre2ABI, rePtr wasmPtr) int {
 	return int(res)
 }
 
+// programSizeModule is implemented by modules built with cre2_program_size
+// and cre2_reverse_program_size.
+type programSizeModule interface {
+	Xcre2_program_size(v0 int32) int32
+	Xcre2_reverse_program_size(v0 int32) int32
+}
+
+func programSize(abi *libre2ABI, rePtr wasmPtr) int {
+	_ = abi
+	// Unknown without the export.
+	size := -1
+	withModuleNoResult(func(m *wasm2go.Module) {
+		if pm, ok := any(m).(programSizeModule); ok {
+			size = int(pm.Xcre2_program_size(int32(rePtr)))
+		}
+	})
+	return size
+}
+
+func reverseProgramSize(abi *libre2ABI, rePtr wasmPtr) int {
+	_ = abi
+	// Unknown without the export.
+	size := -1
+	withModuleNoResult(func(m *wasm2go.Module) {
+		if pm, ok := any(m).(programSizeModule); ok {
+			size = int(pm.Xcre2_reverse_program_size(int32(rePtr)))
+		}
+	})
+	return size
+}
+
+// The Wasm library does not export cre2_extract_re or
+// cre2_check_rewrite_string, so rewrites are done in Go.
+func hasRewrite(_ *libre2ABI) bool {
+	return false
+}
+
+func extractRewrite(_ *Regexp, _ cString, _ cString) (string, bool) {
+	return "", false
+}
+
+func checkRewrite(_ *Regexp, _ cString) (string, bool) {
+	return "", false
+}
+
+// The Wasm library does not export cre2_global_replace_re, so replacements
+// are always done by matching.
+func hasGlobalReplace(_ *libre2ABI) bool {
+	return false
+}
+
+func globalReplace(_ *Regexp, _ *allocation, _ cString, _ cString) ([]byte, bool) {
+	return nil, false
+}
+
 func deleteRE(abi *libre2ABI, rePtr wasmPtr) {
 	_ = abi
 	withModuleNoResult(func(m *wasm2go.Module) {
@@ -214,15 +320,31 @@ func release(re *Regexp) {
 	deleteRE(re.abi, re.ptr)
 }
 
-func match(re *Regexp, s cString, matchesPtr wasmPtr, nMatches uint32) bool {
+func match(re *Regexp, s cString, anchor Anchor, matchesPtr wasmPtr, nMatches uint32) bool {
+	re.enter()
+	defer re.leave()
 	res := withModule(func(m *wasm2go.Module) uint64 {
-		return uint64(m.Xcre2_match(int32(re.ptr), int32(s.ptr), int32(s.length), 0, int32(s.length), 0, int32(matchesPtr), int32(nMatches)))
+		return uint64(m.Xcre2_match(int32(re.ptr), int32(s.ptr), int32(s.length), 0, int32(s.length), int32(anchor.cre2()), int32(matchesPtr), int32(nMatches)))
 	})
 
 	return res == 1
 }
 
+// matchBatch matches each of css, with its matches written to matchesPtrs,
+// using a single module for the whole batch.
+func matchBatch(re *Regexp, css []cString, anchor Anchor, matchesPtrs []wasmPtr, nMatches uint32, matched []bool) {
+	re.enter()
+	defer re.leave()
+	withModuleNoResult(func(m *wasm2go.Module) {
+		for i, s := range css {
+			matched[i] = m.Xcre2_match(int32(re.ptr), int32(s.ptr), int32(s.length), 0, int32(s.length), int32(anchor.cre2()), int32(matchesPtrs[i]), int32(nMatches)) == 1
+		}
+	})
+}
+
 func matchFrom(re *Regexp, s cString, startPos int, matchesPtr wasmPtr, nMatches uint32) bool {
+	re.enter()
+	defer re.leave()
 	res := withModule(func(m *wasm2go.Module) uint64 {
 		return uint64(m.Xcre2_match(int32(re.ptr), int32(s.ptr), int32(s.length), int32(startPos), int32(s.length), 0, int32(matchesPtr), int32(nMatches)))
 	})
@@ -230,6 +352,16 @@ func matchFrom(re *Regexp, s cString, startPos int, matchesPtr wasmPtr, nMatches
 	return res == 1
 }
 
+func matchRange(re *Regexp, s cString, startPos int, endPos int, anchor Anchor, matchesPtr wasmPtr, nMatches uint32) bool {
+	re.enter()
+	defer re.leave()
+	res := withModule(func(m *wasm2go.Module) uint64 {
+		return uint64(m.Xcre2_match(int32(re.ptr), int32(s.ptr), int32(s.length), int32(startPos), int32(endPos), int32(anchor.cre2()), int32(matchesPtr), int32(nMatches)))
+	})
+
+	return res == 1
+}
+
 func readMatch(alloc *allocation, cs cString, matchPtr wasmPtr, dstCap []int) []int {
 	matchBuf := alloc.read(matchPtr, 8)
 	subStrPtr := binary.LittleEndian.Uint32(matchBuf)
@@ -301,44 +433,13 @@ func namedGroupsIterDelete(abi *libre2ABI, iterPtr wasmPtr) {
 	})
 }
 
-func newSet(abi *libre2ABI, opts CompileOptions) wasmPtr {
+func newSet(abi *libre2ABI, opts CompileOptions, anchor Anchor) wasmPtr {
 	_ = abi
-	optPtr := uint32(withModule(func(m *wasm2go.Module) uint64 {
-		return uint64(m.Xcre2_opt_new())
-	}))
-	defer func() {
-		withModuleNoResult(func(m *wasm2go.Module) {
-			m.Xcre2_opt_delete(int32(optPtr))
-		})
-	}()
-
-	withModuleNoResult(func(m *wasm2go.Module) {
-		m.Xcre2_opt_set_max_mem(int32(optPtr), int64(maxSize))
-	})
-
-	if opts.Longest {
-		withModuleNoResult(func(m *wasm2go.Module) {
-			m.Xcre2_opt_set_longest_match(int32(optPtr), 1)
-		})
-	}
-	if opts.Posix {
-		withModuleNoResult(func(m *wasm2go.Module) {
-			m.Xcre2_opt_set_posix_syntax(int32(optPtr), 1)
-		})
-	}
-	if opts.CaseInsensitive {
-		withModuleNoResult(func(m *wasm2go.Module) {
-			m.Xcre2_opt_set_case_sensitive(int32(optPtr), 0)
-		})
-	}
-	if opts.Latin1 {
-		withModuleNoResult(func(m *wasm2go.Module) {
-			m.Xcre2_opt_set_latin1_encoding(int32(optPtr))
-		})
-	}
+	optPtr := newOpt(opts)
+	defer deleteOpt(optPtr)
 
 	res := withModule(func(m *wasm2go.Module) uint64 {
-		return uint64(m.Xcre2_set_new(int32(optPtr), 0))
+		return uint64(m.Xcre2_set_new(int32(optPtr), int32(anchor.cre2())))
 	})
 	return wasmPtr(res)
 }
@@ -367,12 +468,37 @@ func setCompile(set *Set) int32 {
 }
 
 func setMatch(set *Set, cs cString, matchedPtr wasmPtr, nMatch int) int {
+	set.enter()
+	defer set.leave()
 	res := withModule(func(m *wasm2go.Module) uint64 {
 		return uint64(m.Xcre2_set_match(int32(set.ptr), int32(cs.ptr), int32(cs.length), int32(matchedPtr), int32(nMatch)))
 	})
 	return int(res)
 }
 
+// setMatchBatch matches each of css against the set, with the matched patterns
+// written to matchedPtrs, using a single module for the whole batch.
+func setMatchBatch(set *Set, css []cString, matchedPtrs []wasmPtr, nMatch int, counts []int) {
+	set.enter()
+	defer set.leave()
+	withModuleNoResult(func(m *wasm2go.Module) {
+		for i, cs := range css {
+			counts[i] = int(m.Xcre2_set_match(int32(set.ptr), int32(cs.ptr), int32(cs.length), int32(matchedPtrs[i]), int32(nMatch)))
+		}
+	})
+}
+
+// setMatchChecked is like cre2_set_match_checked, which the Wasm library does
+// not export. cre2_set_match reports a failed match as no match, so that is
+// confirmed with Set.mayMatch.
+func setMatchChecked(set *Set, cs cString, matchedPtr wasmPtr, nMatch int) int {
+	count := setMatch(set, cs, matchedPtr, nMatch)
+	if count == 0 && set.mayMatch(cs) {
+		return -setErrorOutOfMemory
+	}
+	return count
+}
+
 func deleteSet(abi *libre2ABI, setPtr wasmPtr) {
 	_ = abi
 	withModuleNoResult(func(m *wasm2go.Module) {
@@ -385,6 +511,11 @@ type cString struct {
 	length int
 }
 
+// slice returns the part of cs from start to end, which must not be empty.
+func (cs cString) slice(start, end int) cString {
+	return cString{ptr: cs.ptr + wasmPtr(start), length: end - start}
+}
+
 type cStringArray struct {
 	ptr wasmPtr
 }
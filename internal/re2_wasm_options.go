@@ -0,0 +1,67 @@
+//go:build !re2_cgo
+
+package internal
+
+import (
+	"errors"
+	"fmt"
+)
+
+// optFlag is a boolean RE2::Options field whose cre2_opt_set_* function is
+// not exported by every build of the Wasm library.
+type optFlag struct {
+	// field is the name of the CompileOptions field.
+	field string
+	// setter is the name of the cre2 function, without the cre2_opt_set_
+	// prefix.
+	setter string
+}
+
+var (
+	optFlagLiteral      = optFlag{field: "Literal", setter: "literal"}
+	optFlagNeverNL      = optFlag{field: "NeverNL", setter: "never_nl"}
+	optFlagDotNL        = optFlag{field: "DotNL", setter: "dot_nl"}
+	optFlagNeverCapture = optFlag{field: "NeverCapture", setter: "never_capture"}
+	optFlagPerlClasses  = optFlag{field: "PerlClasses", setter: "perl_classes"}
+	optFlagWordBoundary = optFlag{field: "WordBoundary", setter: "word_boundary"}
+	optFlagOneLine      = optFlag{field: "OneLine", setter: "one_line"}
+)
+
+// optFlagsToSet returns the boolean options without a setter exported by
+// every build of the Wasm library that must be set to true for opts.
+func optFlagsToSet(opts CompileOptions) []optFlag {
+	var flags []optFlag
+	if opts.Literal {
+		flags = append(flags, optFlagLiteral)
+	}
+	if opts.NeverNL {
+		flags = append(flags, optFlagNeverNL)
+	}
+	if opts.DotNL {
+		flags = append(flags, optFlagDotNL)
+	}
+	if opts.NeverCapture {
+		flags = append(flags, optFlagNeverCapture)
+	}
+	if opts.PerlClasses {
+		flags = append(flags, optFlagPerlClasses)
+	}
+	if opts.WordBoundary {
+		flags = append(flags, optFlagWordBoundary)
+	}
+	if opts.OneLine {
+		flags = append(flags, optFlagOneLine)
+	}
+	return flags
+}
+
+// checkOptions returns an error wrapping errors.ErrUnsupported if opts sets
+// an option whose setter is not exported by the Wasm library.
+func checkOptions(abi *libre2ABI, opts CompileOptions) error {
+	for _, f := range optFlagsToSet(opts) {
+		if !hasOptSetter(abi, f) {
+			return fmt.Errorf("re2: option %s requires a build of the Wasm library exporting cre2_opt_set_%s: %w", f.field, f.setter, errors.ErrUnsupported)
+		}
+	}
+	return nil
+}
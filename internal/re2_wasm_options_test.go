@@ -0,0 +1,46 @@
+//go:build !re2_cgo
+
+package internal
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCheckOptions(t *testing.T) {
+	abi := newABI()
+	if err := checkOptions(abi, CompileOptions{Posix: true, Longest: true, CaseInsensitive: true, Latin1: true}); err != nil {
+		t.Errorf("checkOptions() with exported setters: %v", err)
+	}
+
+	tests := []struct {
+		flag optFlag
+		opts CompileOptions
+	}{
+		{optFlagLiteral, CompileOptions{Literal: true}},
+		{optFlagNeverNL, CompileOptions{NeverNL: true}},
+		{optFlagDotNL, CompileOptions{DotNL: true}},
+		{optFlagNeverCapture, CompileOptions{NeverCapture: true}},
+		{optFlagPerlClasses, CompileOptions{Posix: true, PerlClasses: true}},
+		{optFlagWordBoundary, CompileOptions{Posix: true, WordBoundary: true}},
+		{optFlagOneLine, CompileOptions{Posix: true, OneLine: true}},
+	}
+	for _, tc := range tests {
+		tt := tc
+		t.Run(tt.flag.field, func(t *testing.T) {
+			_, err := Compile(`a`, tt.opts)
+			if hasOptSetter(abi, tt.flag) {
+				if err != nil {
+					t.Errorf("Compile(): %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, errors.ErrUnsupported) {
+				t.Errorf("Compile() error = %v, want errors.ErrUnsupported", err)
+			}
+			if _, err := CompileSet([]string{`a`}, tt.opts, Unanchored); !errors.Is(err, errors.ErrUnsupported) {
+				t.Errorf("CompileSet() error = %v, want errors.ErrUnsupported", err)
+			}
+		})
+	}
+}
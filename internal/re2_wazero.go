@@ -51,6 +51,8 @@ type libre2ABI struct {
 	cre2Delete                lazyFunction
 	cre2Match                 lazyFunction
 	cre2NumCapturingGroups    lazyFunction
+	cre2ProgramSize           lazyFunction
+	cre2ReverseProgramSize    lazyFunction
 	cre2ErrorCode             lazyFunction
 	cre2ErrorArg              lazyFunction
 	cre2NamedGroupsIterNew    lazyFunction
@@ -60,7 +62,14 @@ type libre2ABI struct {
 	cre2OptDelete             lazyFunction
 	cre2OptSetLongestMatch    lazyFunction
 	cre2OptSetPosixSyntax     lazyFunction
+	cre2OptSetLiteral         lazyFunction
+	cre2OptSetNeverNL         lazyFunction
+	cre2OptSetDotNL           lazyFunction
+	cre2OptSetNeverCapture    lazyFunction
 	cre2OptSetCaseSensitive   lazyFunction
+	cre2OptSetPerlClasses     lazyFunction
+	cre2OptSetWordBoundary    lazyFunction
+	cre2OptSetOneLine         lazyFunction
 	cre2OptSetLatin1Encoding  lazyFunction
 	cre2OptSetMaxMem          lazyFunction
 
@@ -239,6 +248,8 @@ func newABI() *libre2ABI {
 		cre2Delete:                newLazyFunction("cre2_delete"),
 		cre2Match:                 newLazyFunction("cre2_match"),
 		cre2NumCapturingGroups:    newLazyFunction("cre2_num_capturing_groups"),
+		cre2ProgramSize:           newLazyFunction("cre2_program_size"),
+		cre2ReverseProgramSize:    newLazyFunction("cre2_reverse_program_size"),
 		cre2ErrorCode:             newLazyFunction("cre2_error_code"),
 		cre2ErrorArg:              newLazyFunction("cre2_error_arg"),
 		cre2NamedGroupsIterNew:    newLazyFunction("cre2_named_groups_iter_new"),
@@ -248,7 +259,14 @@ func newABI() *libre2ABI {
 		cre2OptDelete:             newLazyFunction("cre2_opt_delete"),
 		cre2OptSetLongestMatch:    newLazyFunction("cre2_opt_set_longest_match"),
 		cre2OptSetPosixSyntax:     newLazyFunction("cre2_opt_set_posix_syntax"),
+		cre2OptSetLiteral:         newLazyFunction("cre2_opt_set_literal"),
+		cre2OptSetNeverNL:         newLazyFunction("cre2_opt_set_never_nl"),
+		cre2OptSetDotNL:           newLazyFunction("cre2_opt_set_dot_nl"),
+		cre2OptSetNeverCapture:    newLazyFunction("cre2_opt_set_never_capture"),
 		cre2OptSetCaseSensitive:   newLazyFunction("cre2_opt_set_case_sensitive"),
+		cre2OptSetPerlClasses:     newLazyFunction("cre2_opt_set_perl_classes"),
+		cre2OptSetWordBoundary:    newLazyFunction("cre2_opt_set_word_boundary"),
+		cre2OptSetOneLine:         newLazyFunction("cre2_opt_set_one_line"),
 		cre2OptSetLatin1Encoding:  newLazyFunction("cre2_opt_set_latin1_encoding"),
 		cre2OptSetMaxMem:          newLazyFunction("cre2_opt_set_max_mem"),
 		cre2SetNew:                newLazyFunction("cre2_set_new"),
@@ -271,21 +289,15 @@ func (abi *libre2ABI) endOperation(a allocation) {
 	a.free()
 }
 
-func newRE(abi *libre2ABI, pattern cString, opts CompileOptions) wasmPtr {
+func newOpt(abi *libre2ABI, opts CompileOptions) uint32 {
 	ctx := context.Background()
-	optPtr := uint32(0)
 	res, err := abi.cre2OptNew.Call0(ctx)
 	if err != nil {
 		panic(err)
 	}
-	optPtr = uint32(res)
-	defer func() {
-		if _, err := abi.cre2OptDelete.Call1(ctx, uint64(optPtr)); err != nil {
-			panic(err)
-		}
-	}()
+	optPtr := uint32(res)
 
-	_, err = abi.cre2OptSetMaxMem.Call2(ctx, uint64(optPtr), uint64(maxSize))
+	_, err = abi.cre2OptSetMaxMem.Call2(ctx, uint64(optPtr), uint64(opts.maxMem()))
 	if err != nil {
 		panic(err)
 	}
@@ -314,8 +326,52 @@ func newRE(abi *libre2ABI, pattern cString, opts CompileOptions) wasmPtr {
 			panic(err)
 		}
 	}
+	for _, f := range optFlagsToSet(opts) {
+		// Checked by checkOptions before compiling.
+		if _, err := abi.optSetter(f).Call2(ctx, uint64(optPtr), 1); err != nil {
+			panic(err)
+		}
+	}
+
+	return optPtr
+}
+
+func hasOptSetter(abi *libre2ABI, f optFlag) bool {
+	return abi.optSetter(f).exported(context.Background())
+}
+
+func (abi *libre2ABI) optSetter(f optFlag) *lazyFunction {
+	switch f {
+	case optFlagLiteral:
+		return &abi.cre2OptSetLiteral
+	case optFlagNeverNL:
+		return &abi.cre2OptSetNeverNL
+	case optFlagDotNL:
+		return &abi.cre2OptSetDotNL
+	case optFlagNeverCapture:
+		return &abi.cre2OptSetNeverCapture
+	case optFlagPerlClasses:
+		return &abi.cre2OptSetPerlClasses
+	case optFlagWordBoundary:
+		return &abi.cre2OptSetWordBoundary
+	case optFlagOneLine:
+		return &abi.cre2OptSetOneLine
+	}
+	panic("re2: unknown option " + f.field)
+}
+
+func deleteOpt(abi *libre2ABI, optPtr uint32) {
+	if _, err := abi.cre2OptDelete.Call1(context.Background(), uint64(optPtr)); err != nil {
+		panic(err)
+	}
+}
+
+func newRE(abi *libre2ABI, pattern cString, opts CompileOptions) wasmPtr {
+	ctx := context.Background()
+	optPtr := newOpt(abi, opts)
+	defer deleteOpt(abi, optPtr)
 
-	res, err = abi.cre2New.Call3(ctx, uint64(pattern.ptr), uint64(pattern.length), uint64(optPtr))
+	res, err := abi.cre2New.Call3(ctx, uint64(pattern.ptr), uint64(pattern.length), uint64(optPtr))
 	if err != nil {
 		panic(err)
 	}
@@ -350,6 +406,56 @@ func numCapturingGroups(abi *libre2ABI, rePtr wasmPtr) int {
 	return int(res)
 }
 
+func programSize(abi *libre2ABI, rePtr wasmPtr) int {
+	ctx := context.Background()
+	if !abi.cre2ProgramSize.exported(ctx) {
+		// Unknown without the export.
+		return -1
+	}
+	res, err := abi.cre2ProgramSize.Call1(ctx, uint64(rePtr))
+	if err != nil {
+		panic(err)
+	}
+	return int(int32(res))
+}
+
+func reverseProgramSize(abi *libre2ABI, rePtr wasmPtr) int {
+	ctx := context.Background()
+	if !abi.cre2ReverseProgramSize.exported(ctx) {
+		// Unknown without the export.
+		return -1
+	}
+	res, err := abi.cre2ReverseProgramSize.Call1(ctx, uint64(rePtr))
+	if err != nil {
+		panic(err)
+	}
+	return int(int32(res))
+}
+
+// The Wasm library does not export cre2_extract_re or
+// cre2_check_rewrite_string, so rewrites are done in Go.
+func hasRewrite(_ *libre2ABI) bool {
+	return false
+}
+
+func extractRewrite(_ *Regexp, _ cString, _ cString) (string, bool) {
+	return "", false
+}
+
+func checkRewrite(_ *Regexp, _ cString) (string, bool) {
+	return "", false
+}
+
+// The Wasm library does not export cre2_global_replace_re, so replacements
+// are always done by matching.
+func hasGlobalReplace(_ *libre2ABI) bool {
+	return false
+}
+
+func globalReplace(_ *Regexp, _ *allocation, _ cString, _ cString) ([]byte, bool) {
+	return nil, false
+}
+
 func deleteRE(abi *libre2ABI, rePtr wasmPtr) {
 	ctx := context.Background()
 	if _, err := abi.cre2Delete.Call1(ctx, uint64(rePtr)); err != nil {
@@ -361,9 +467,11 @@ func release(re *Regexp) {
 	deleteRE(re.abi, re.ptr)
 }
 
-func match(re *Regexp, s cString, matchesPtr wasmPtr, nMatches uint32) bool {
+func match(re *Regexp, s cString, anchor Anchor, matchesPtr wasmPtr, nMatches uint32) bool {
+	re.enter()
+	defer re.leave()
 	ctx := context.Background()
-	res, err := re.abi.cre2Match.Call8(ctx, uint64(re.ptr), uint64(s.ptr), uint64(s.length), 0, uint64(s.length), 0, uint64(matchesPtr), uint64(nMatches))
+	res, err := re.abi.cre2Match.Call8(ctx, uint64(re.ptr), uint64(s.ptr), uint64(s.length), 0, uint64(s.length), uint64(anchor.cre2()), uint64(matchesPtr), uint64(nMatches))
 	if err != nil {
 		panic(err)
 	}
@@ -371,7 +479,29 @@ func match(re *Regexp, s cString, matchesPtr wasmPtr, nMatches uint32) bool {
 	return res == 1
 }
 
+// matchBatch matches each of css, with its matches written to matchesPtrs,
+// using a single module for the whole batch.
+func matchBatch(re *Regexp, css []cString, anchor Anchor, matchesPtrs []wasmPtr, nMatches uint32, matched []bool) {
+	re.enter()
+	defer re.leave()
+	ctx := context.Background()
+	modH := getChildModule(ctx)
+	defer putChildModule(modH)
+
+	var callStack [8]uint64
+	for i, s := range css {
+		callStack = [8]uint64{uint64(re.ptr), uint64(s.ptr), uint64(s.length), 0, uint64(s.length), uint64(anchor.cre2()), uint64(matchesPtrs[i]), uint64(nMatches)}
+		res, err := re.abi.cre2Match.callOnModule(ctx, modH, callStack[:])
+		if err != nil {
+			panic(err)
+		}
+		matched[i] = res == 1
+	}
+}
+
 func matchFrom(re *Regexp, s cString, startPos int, matchesPtr wasmPtr, nMatches uint32) bool {
+	re.enter()
+	defer re.leave()
 	ctx := context.Background()
 	res, err := re.abi.cre2Match.Call8(ctx, uint64(re.ptr), uint64(s.ptr), uint64(s.length), uint64(startPos), uint64(s.length), 0, uint64(matchesPtr), uint64(nMatches))
 	if err != nil {
@@ -381,6 +511,18 @@ func matchFrom(re *Regexp, s cString, startPos int, matchesPtr wasmPtr, nMatches
 	return res == 1
 }
 
+func matchRange(re *Regexp, s cString, startPos int, endPos int, anchor Anchor, matchesPtr wasmPtr, nMatches uint32) bool {
+	re.enter()
+	defer re.leave()
+	ctx := context.Background()
+	res, err := re.abi.cre2Match.Call8(ctx, uint64(re.ptr), uint64(s.ptr), uint64(s.length), uint64(startPos), uint64(endPos), uint64(anchor.cre2()), uint64(matchesPtr), uint64(nMatches))
+	if err != nil {
+		panic(err)
+	}
+
+	return res == 1
+}
+
 func readMatch(alloc *allocation, cs cString, matchPtr wasmPtr, dstCap []int) []int {
 	matchBuf := alloc.read(matchPtr, 8)
 	subStrPtr := binary.LittleEndian.Uint32(matchBuf)
@@ -463,51 +605,12 @@ func namedGroupsIterDelete(abi *libre2ABI, iterPtr wasmPtr) {
 	}
 }
 
-func newSet(abi *libre2ABI, opts CompileOptions) wasmPtr {
+func newSet(abi *libre2ABI, opts CompileOptions, anchor Anchor) wasmPtr {
 	ctx := context.Background()
-	optPtr := uint32(0)
-	res, err := abi.cre2OptNew.Call0(ctx)
-	if err != nil {
-		panic(err)
-	}
-	optPtr = uint32(res)
-	defer func() {
-		if _, err := abi.cre2OptDelete.Call1(ctx, uint64(optPtr)); err != nil {
-			panic(err)
-		}
-	}()
-
-	_, err = abi.cre2OptSetMaxMem.Call2(ctx, uint64(optPtr), uint64(maxSize))
-	if err != nil {
-		panic(err)
-	}
-
-	if opts.Longest {
-		_, err = abi.cre2OptSetLongestMatch.Call2(ctx, uint64(optPtr), 1)
-		if err != nil {
-			panic(err)
-		}
-	}
-	if opts.Posix {
-		_, err = abi.cre2OptSetPosixSyntax.Call2(ctx, uint64(optPtr), 1)
-		if err != nil {
-			panic(err)
-		}
-	}
-	if opts.CaseInsensitive {
-		_, err = abi.cre2OptSetCaseSensitive.Call2(ctx, uint64(optPtr), 0)
-		if err != nil {
-			panic(err)
-		}
-	}
-	if opts.Latin1 {
-		_, err = abi.cre2OptSetLatin1Encoding.Call1(ctx, uint64(optPtr))
-		if err != nil {
-			panic(err)
-		}
-	}
+	optPtr := newOpt(abi, opts)
+	defer deleteOpt(abi, optPtr)
 
-	res, err = abi.cre2SetNew.Call2(ctx, uint64(optPtr), 0)
+	res, err := abi.cre2SetNew.Call2(ctx, uint64(optPtr), uint64(anchor.cre2()))
 	if err != nil {
 		panic(err)
 	}
@@ -542,6 +645,8 @@ func setCompile(set *Set) int32 {
 }
 
 func setMatch(set *Set, cs cString, matchedPtr wasmPtr, nMatch int) int {
+	set.enter()
+	defer set.leave()
 	ctx := context.Background()
 	res, err := set.abi.cre2SetMatch.Call5(ctx, uint64(set.ptr), uint64(cs.ptr), uint64(cs.length), uint64(matchedPtr), uint64(nMatch))
 	if err != nil {
@@ -550,6 +655,37 @@ func setMatch(set *Set, cs cString, matchedPtr wasmPtr, nMatch int) int {
 	return int(res)
 }
 
+// setMatchBatch matches each of css against the set, with the matched patterns
+// written to matchedPtrs, using a single module for the whole batch.
+func setMatchBatch(set *Set, css []cString, matchedPtrs []wasmPtr, nMatch int, counts []int) {
+	set.enter()
+	defer set.leave()
+	ctx := context.Background()
+	modH := getChildModule(ctx)
+	defer putChildModule(modH)
+
+	var callStack [5]uint64
+	for i, cs := range css {
+		callStack = [5]uint64{uint64(set.ptr), uint64(cs.ptr), uint64(cs.length), uint64(matchedPtrs[i]), uint64(nMatch)}
+		res, err := set.abi.cre2SetMatch.callOnModule(ctx, modH, callStack[:])
+		if err != nil {
+			panic(err)
+		}
+		counts[i] = int(res)
+	}
+}
+
+// setMatchChecked is like cre2_set_match_checked, which the Wasm library does
+// not export. cre2_set_match reports a failed match as no match, so that is
+// confirmed with Set.mayMatch.
+func setMatchChecked(set *Set, cs cString, matchedPtr wasmPtr, nMatch int) int {
+	count := setMatch(set, cs, matchedPtr, nMatch)
+	if count == 0 && set.mayMatch(cs) {
+		return -setErrorOutOfMemory
+	}
+	return count
+}
+
 func deleteSet(abi *libre2ABI, setPtr wasmPtr) {
 	ctx := context.Background()
 	_, err := abi.cre2SetDelete.Call1(ctx, uint64(setPtr))
@@ -563,6 +699,11 @@ type cString struct {
 	length int
 }
 
+// slice returns the part of cs from start to end, which must not be empty.
+func (cs cString) slice(start, end int) cString {
+	return cString{ptr: cs.ptr + wasmPtr(start), length: end - start}
+}
+
 type cStringArray struct {
 	ptr wasmPtr
 }
@@ -707,6 +848,15 @@ func (f *lazyFunction) Call3(ctx context.Context, arg1 uint64, arg2 uint64, arg3
 	return f.callWithStack(ctx, callStack[:])
 }
 
+func (f *lazyFunction) Call4(ctx context.Context, arg1 uint64, arg2 uint64, arg3 uint64, arg4 uint64) (uint64, error) {
+	var callStack [4]uint64
+	callStack[0] = arg1
+	callStack[1] = arg2
+	callStack[2] = arg3
+	callStack[3] = arg4
+	return f.callWithStack(ctx, callStack[:])
+}
+
 func (f *lazyFunction) Call5(ctx context.Context, arg1 uint64, arg2 uint64, arg3 uint64, arg4 uint64, arg5 uint64) (uint64, error) {
 	var callStack [5]uint64
 	callStack[0] = arg1
@@ -730,10 +880,26 @@ func (f *lazyFunction) Call8(ctx context.Context, arg1 uint64, arg2 uint64, arg3
 	return f.callWithStack(ctx, callStack[:])
 }
 
+// exported reports whether the module exports the function. Functions added to
+// cre2 are missing until the module is rebuilt.
+func (f *lazyFunction) exported(ctx context.Context) bool {
+	wasmInitOnce.Do(func() {
+		initWASM(ctx)
+	})
+	_, ok := wasmCompiled.ExportedFunctions()[f.name]
+	return ok
+}
+
 func (f *lazyFunction) callWithStack(ctx context.Context, callStack []uint64) (uint64, error) {
 	modH := getChildModule(ctx)
 	defer putChildModule(modH)
 
+	return f.callOnModule(ctx, modH, callStack)
+}
+
+// callOnModule calls the function on an already checked out module, allowing
+// many calls to share a module.
+func (f *lazyFunction) callOnModule(ctx context.Context, modH *childModule, callStack []uint64) (uint64, error) {
 	fun := modH.functions[f.name]
 	if fun == nil {
 		fun = modH.mod.ExportedFunction(f.name)
@@ -0,0 +1,283 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"runtime"
+	"unicode/utf8"
+)
+
+// DefaultReaderWindow is the window used by MatchReader, FindReaderIndex,
+// FindReaderSubmatchIndex and the ReplaceAll Writer methods.
+const DefaultReaderWindow = 1 << 20
+
+// minReaderWindow keeps the window large enough for a search to always make progress.
+const minReaderWindow = 16
+
+// ErrWindowExceeded is returned when reading from a reader finds a match that
+// may be longer than the window, so it cannot be determined without buffering
+// more of the input.
+var ErrWindowExceeded = errors.New("regexp: match may exceed reader window")
+
+// MatchReader reports whether the text returned by the RuneReader
+// contains any match of the regular expression re.
+//
+// The input is buffered DefaultReaderWindow bytes at a time, and more only
+// while a match longer than the window may start in the buffered input. Use
+// MatchReaderWindow to bound the buffered input.
+func (re *Regexp) MatchReader(r io.RuneReader) bool {
+	res, _ := re.matchReader(r, DefaultReaderWindow, true)
+	return res
+}
+
+// MatchReaderWindow is like MatchReader but buffers at most twice window
+// bytes of the input at a time. Any match no longer than window is found,
+// and ErrWindowExceeded is returned if there is none but a longer match may
+// have been discarded from the buffered input. As with MatchReader, an error reading from r
+// ends the input, and it is returned along with the result for the input read
+// until then.
+func (re *Regexp) MatchReaderWindow(r io.RuneReader, window int) (bool, error) {
+	return re.matchReader(r, window, false)
+}
+
+func (re *Regexp) matchReader(r io.RuneReader, window int, grow bool) (bool, error) {
+	w := newReaderWindow(r, window)
+	// A later match may still be found after discarding one which may be
+	// longer than the window.
+	var discarded error
+	for {
+		w.fill()
+		end := w.end()
+		limit := w.limit(re.opts.Latin1)
+		loc, exceeded := re.findInWindow(w.buf, w.ctx, end, limit, 0)
+		switch {
+		case loc != nil:
+			return true, w.err
+		case exceeded && grow:
+			w.window *= 2
+			continue
+		case exceeded:
+			discarded = ErrWindowExceeded
+		case w.eof:
+			if w.err != nil {
+				return false, w.err
+			}
+			return false, discarded
+		}
+		w.discard(limit)
+	}
+}
+
+// FindReaderIndex returns a two-element slice of integers defining the
+// location of the leftmost match of the regular expression in text read from
+// the RuneReader. The match text was found in the input stream at
+// byte offset loc[0] through loc[1]-1.
+// A return value of nil indicates no match.
+//
+// The input is buffered DefaultReaderWindow bytes at a time, and more only
+// while the leftmost match may be longer than the window. Use
+// FindReaderIndexWindow to bound the buffered input.
+func (re *Regexp) FindReaderIndex(r io.RuneReader) (loc []int) {
+	res, _ := re.findReader(r, DefaultReaderWindow, 1, true)
+	return res
+}
+
+// FindReaderIndexWindow is like FindReaderIndex but buffers at most twice
+// window bytes of the input at a time. Any match no longer than window is
+// found, and ErrWindowExceeded is returned if the leftmost match may be longer.
+// An error reading from r is returned as described in MatchReaderWindow.
+func (re *Regexp) FindReaderIndexWindow(r io.RuneReader, window int) ([]int, error) {
+	return re.findReader(r, window, 1, false)
+}
+
+// FindReaderSubmatchIndex returns a slice holding the index pairs
+// identifying the leftmost match of the regular expression of text read by
+// the RuneReader, and the matches, if any, of its subexpressions, as defined
+// by the 'Submatch' and 'Index' descriptions in the package comment. A
+// return value of nil indicates no match.
+//
+// The input is buffered DefaultReaderWindow bytes at a time, and more only
+// while the leftmost match may be longer than the window. Use
+// FindReaderSubmatchIndexWindow to bound the buffered input.
+func (re *Regexp) FindReaderSubmatchIndex(r io.RuneReader) []int {
+	res, _ := re.findReader(r, DefaultReaderWindow, re.numMatches, true)
+	return res
+}
+
+// FindReaderSubmatchIndexWindow is like FindReaderSubmatchIndex but buffers
+// at most twice window bytes of the input at a time. Any match no longer than
+// window is found, and ErrWindowExceeded is returned if the leftmost match may
+// be longer.
+func (re *Regexp) FindReaderSubmatchIndexWindow(r io.RuneReader, window int) ([]int, error) {
+	return re.findReader(r, window, re.numMatches, false)
+}
+
+// findReader finds the leftmost match in the input of r. If grow is set, the
+// window is enlarged instead of returning ErrWindowExceeded.
+func (re *Regexp) findReader(r io.RuneReader, window int, nmatch int, grow bool) ([]int, error) {
+	w := newReaderWindow(r, window)
+	for {
+		w.fill()
+		end := w.end()
+		limit := w.limit(re.opts.Latin1)
+		loc, exceeded := re.findInWindow(w.buf, w.ctx, end, limit, nmatch)
+		switch {
+		case exceeded && grow:
+			w.window *= 2
+			continue
+		case exceeded:
+			return nil, ErrWindowExceeded
+		case w.eof:
+			return w.offset(loc), w.err
+		case loc != nil && loc[0] < limit:
+			// Any match starting earlier would continue past end, which was
+			// ruled out.
+			return w.offset(loc), nil
+		}
+		w.discard(limit)
+	}
+}
+
+// findInWindow searches b[start:end] for the leftmost match, returning nmatch
+// index pairs relative to b. If nmatch is 0, a non-nil empty slice is returned
+// for a match. It also reports whether a match starting before limit, and
+// not after the one found, may continue past end, in which case the input
+// before limit can't be discarded.
+func (re *Regexp) findInWindow(b []byte, start, end, limit int, nmatch int) ([]int, bool) {
+	alloc := re.abi.startOperation(len(b) + 8*max(nmatch, 1))
+	defer re.abi.endOperation(alloc)
+
+	cs := alloc.newCStringFromBytes(b)
+	matchArr := alloc.newCStringArray(max(nmatch, 1))
+	defer matchArr.free()
+
+	var res []int
+	if matchRange(re, cs, start, end, Unanchored, matchArr.ptr, uint32(nmatch)) {
+		res = make([]int, 0, 2*nmatch)
+		readMatches(&alloc, cs, matchArr.ptr, nmatch, func(match []int) bool {
+			res = append(res, match...)
+			return true
+		})
+	}
+
+	exceeded := false
+	if start < limit && limit <= end {
+		if p := re.partialStart(&alloc, cs, start, end, matchArr); p >= 0 && p < limit {
+			exceeded = res == nil || nmatch == 0 || p <= res[0]
+		}
+	}
+
+	runtime.KeepAlive(b)
+	runtime.KeepAlive(matchArr)
+	runtime.KeepAlive(re) // don't allow finalizer to run during method
+
+	return res, exceeded
+}
+
+// readerWindow buffers a bounded part of the input of a RuneReader.
+type readerWindow struct {
+	r io.RuneReader
+	// rd is r if it also implements io.Reader, allowing reading in chunks.
+	rd io.Reader
+
+	window int
+	// buf holds the input starting at offset base.
+	buf  []byte
+	base int
+	// ctx is the number of bytes at the start of buf which have already been
+	// searched and are only kept as context for ^ and \b.
+	ctx int
+	eof bool
+	// err is the error other than io.EOF which ended the input, if any.
+	err error
+}
+
+func newReaderWindow(r io.RuneReader, window int) *readerWindow {
+	if window < minReaderWindow {
+		window = minReaderWindow
+	}
+	w := &readerWindow{
+		r:      r,
+		window: window,
+	}
+	if rd, ok := r.(io.Reader); ok {
+		w.rd = rd
+	}
+	return w
+}
+
+// fill reads until buf holds twice the window, plus a byte of lookahead, or
+// the input is exhausted.
+func (w *readerWindow) fill() {
+	size := 2*w.window + 1
+	if cap(w.buf) < size+utf8.UTFMax {
+		buf := make([]byte, len(w.buf), size+utf8.UTFMax)
+		copy(buf, w.buf)
+		w.buf = buf
+	}
+
+	for !w.eof && len(w.buf) < size {
+		var err error
+		if w.rd != nil {
+			var n int
+			n, err = w.rd.Read(w.buf[len(w.buf):size])
+			w.buf = w.buf[:len(w.buf)+n]
+		} else {
+			var c rune
+			c, _, err = w.r.ReadRune()
+			if err == nil {
+				w.buf = utf8.AppendRune(w.buf, c)
+			}
+		}
+		if err != nil {
+			// Like the standard library, treat any error as the end of the input.
+			w.eof = true
+			if !errors.Is(err, io.EOF) {
+				w.err = fmt.Errorf("regexp: reading input: %w", err)
+			}
+		}
+	}
+}
+
+// end returns the end of the range of buf to search. Unless the input is
+// exhausted, the last byte is only used as context for $ and \b.
+func (w *readerWindow) end() int {
+	if w.eof {
+		return len(w.buf)
+	}
+	return len(w.buf) - 1
+}
+
+// limit returns the position before which a match must start to be known to
+// fit in the window, which is also where the input can be discarded up to.
+// Once the input is exhausted, it is past the end of the input.
+func (w *readerWindow) limit(latin1 bool) int {
+	if w.eof {
+		return len(w.buf) + 1
+	}
+	limit := w.end() - w.window
+	// Keep the search position at the start of a rune.
+	for i := 1; i < utf8.UTFMax && !latin1 && !utf8.RuneStart(w.buf[limit]); i++ {
+		limit--
+	}
+	return limit
+}
+
+// discard drops the input before buf[n], keeping the preceding byte as context.
+func (w *readerWindow) discard(n int) {
+	n--
+	w.base += n
+	w.buf = w.buf[:copy(w.buf, w.buf[n:])]
+	w.ctx = 1
+}
+
+// offset converts loc from indices in buf to offsets in the input.
+func (w *readerWindow) offset(loc []int) []int {
+	for i, idx := range loc {
+		if idx >= 0 {
+			loc[i] = idx + w.base
+		}
+	}
+	return loc
+}
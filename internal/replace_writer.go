@@ -0,0 +1,188 @@
+package internal
+
+import (
+	"bytes"
+	"io"
+	"runtime"
+)
+
+// ReplaceAllWriter writes to w a copy of the input read from r, replacing
+// matches of the Regexp with the replacement text repl as with ReplaceAll.
+// Inside repl, $ signs are interpreted as in Expand. It returns the number of
+// bytes written.
+//
+// The output is written as matches are found, buffering at most twice
+// DefaultReaderWindow bytes of the input at a time. ErrWindowExceeded is
+// returned if a match may be longer than DefaultReaderWindow, after writing
+// the output preceding that match. An error reading from r ends the input and is
+// returned after writing the output for the input read until then.
+func (re *Regexp) ReplaceAllWriter(w io.Writer, r io.Reader, repl []byte) (int64, error) {
+	return re.ReplaceAllWriterWindow(w, r, repl, DefaultReaderWindow)
+}
+
+// ReplaceAllWriterWindow is like ReplaceAllWriter but buffers at most twice
+// window bytes of the input at a time. Any match no longer than window is
+// replaced.
+func (re *Regexp) ReplaceAllWriterWindow(w io.Writer, r io.Reader, repl []byte, window int) (int64, error) {
+	nmatch := 1
+	if bytes.IndexByte(repl, '$') >= 0 {
+		nmatch = re.numMatches
+	}
+	srepl := string(repl)
+	return re.replaceWriter(w, r, window, nmatch, func(dst []byte, src []byte, match []int) []byte {
+		return re.expand(dst, srepl, src, "", match)
+	})
+}
+
+// ReplaceAllLiteralWriter is like ReplaceAllWriter but the replacement repl
+// is substituted directly, without using Expand.
+func (re *Regexp) ReplaceAllLiteralWriter(w io.Writer, r io.Reader, repl []byte) (int64, error) {
+	return re.ReplaceAllLiteralWriterWindow(w, r, repl, DefaultReaderWindow)
+}
+
+// ReplaceAllLiteralWriterWindow is like ReplaceAllLiteralWriter but buffers
+// at most twice window bytes of the input at a time.
+func (re *Regexp) ReplaceAllLiteralWriterWindow(w io.Writer, r io.Reader, repl []byte, window int) (int64, error) {
+	return re.replaceWriter(w, r, window, 1, func(dst []byte, _ []byte, _ []int) []byte {
+		return append(dst, repl...)
+	})
+}
+
+// ReplaceAllFuncWriter is like ReplaceAllWriter but replaces matches with the
+// return value of repl applied to the matched byte slice, as with
+// ReplaceAllFunc. The matched slice is only valid during the call to repl.
+func (re *Regexp) ReplaceAllFuncWriter(w io.Writer, r io.Reader, repl func([]byte) []byte) (int64, error) {
+	return re.ReplaceAllFuncWriterWindow(w, r, repl, DefaultReaderWindow)
+}
+
+// ReplaceAllFuncWriterWindow is like ReplaceAllFuncWriter but buffers at most
+// twice window bytes of the input at a time.
+func (re *Regexp) ReplaceAllFuncWriterWindow(w io.Writer, r io.Reader, repl func([]byte) []byte, window int) (int64, error) {
+	return re.replaceWriter(w, r, window, 1, func(dst []byte, src []byte, match []int) []byte {
+		return append(dst, repl(src[match[0]:match[1]])...)
+	})
+}
+
+func (re *Regexp) replaceWriter(w io.Writer, r io.Reader, window int, nmatch int, repl func(dst []byte, src []byte, match []int) []byte) (int64, error) {
+	in := newStreamWindow(r, window)
+
+	var written int64
+	var dst []byte
+	match := make([]int, 0, 2*nmatch)
+
+	// Indices in in.buf of the search position, the end of the input already
+	// written and the end of the previous match.
+	pos := 0
+	last := 0
+	prevMatchEnd := -1
+	for {
+		in.fill()
+		end := in.end()
+		// Only matches starting before limit are replaced, since one starting
+		// later may continue past the buffered input.
+		limit := in.limit(re.opts.Latin1)
+
+		err := func() error {
+			alloc := re.abi.startOperation(len(in.buf) + 8*nmatch)
+			defer re.abi.endOperation(alloc)
+
+			cs := alloc.newCStringFromBytes(in.buf)
+			matchArr := alloc.newCStringArray(nmatch)
+			defer matchArr.free()
+
+			// partial is the leftmost position from pos where a match may start
+			// and continue past end, or -1 if there is none.
+			partial := -1
+			checked := false
+			exceeds := func(matchStart int) bool {
+				if in.eof {
+					return false
+				}
+				if !checked || (partial >= 0 && partial < pos) {
+					partial = re.partialStart(&alloc, cs, pos, end, matchArr)
+					checked = true
+				}
+				return partial >= pos && partial < limit && partial <= matchStart
+			}
+
+			for pos < limit {
+				if !matchRange(re, cs, pos, end, Unanchored, matchArr.ptr, uint32(nmatch)) {
+					if exceeds(end) {
+						break
+					}
+					pos = limit
+					break
+				}
+
+				match = match[:0]
+				readMatches(&alloc, cs, matchArr.ptr, nmatch, func(m []int) bool {
+					match = append(match, m...)
+					return true
+				})
+				if exceeds(match[0]) {
+					break
+				}
+				if match[0] >= limit {
+					pos = match[0]
+					break
+				}
+
+				// Check if it's an empty match following a match, which we ignore.
+				accept := match[0] != match[1] || match[0] != prevMatchEnd
+				pos = nextPos(in.buf, "", pos, match[1])
+				if accept {
+					dst = append(dst, in.buf[last:match[0]]...)
+					dst = repl(dst, in.buf, match)
+					last = match[1]
+				}
+				prevMatchEnd = match[1]
+			}
+
+			runtime.KeepAlive(matchArr)
+			runtime.KeepAlive(re) // don't allow finalizer to run during method
+
+			if partial >= pos && partial < limit {
+				// The match may continue past the buffered input.
+				dst = append(dst, in.buf[last:max(last, partial)]...)
+				return ErrWindowExceeded
+			}
+			return nil
+		}()
+
+		if err == nil {
+			// No more matches start before pos.
+			flushed := min(pos, len(in.buf))
+			dst = append(dst, in.buf[last:flushed]...)
+			last = flushed
+		}
+		n, werr := w.Write(dst)
+		written += int64(n)
+		dst = dst[:0]
+		switch {
+		case werr != nil:
+			return written, werr
+		case err != nil:
+			return written, err
+		case in.eof:
+			return written, in.err
+		}
+
+		// discard keeps the byte before pos as context.
+		shift := pos - 1
+		in.discard(pos)
+		pos -= shift
+		last -= shift
+		prevMatchEnd -= shift
+	}
+}
+
+// newStreamWindow returns a readerWindow reading the input from rd in chunks.
+func newStreamWindow(rd io.Reader, window int) *readerWindow {
+	if window < minReaderWindow {
+		window = minReaderWindow
+	}
+	return &readerWindow{
+		rd:     rd,
+		window: window,
+	}
+}
@@ -0,0 +1,222 @@
+package internal
+
+import (
+	"fmt"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+// Replacer replaces the matches of all the patterns of a Set in a single
+// left-to-right pass over the input. Where matches of several patterns
+// overlap, the leftmost match is replaced, preferring the lowest pattern index
+// among matches starting at the same position. Matches overlapping a replaced
+// match are dropped, and as with Regexp.ReplaceAll, an empty match
+// immediately after a replaced match is ignored.
+//
+// A Replacer is safe for concurrent use.
+type Replacer struct {
+	set       *Set
+	regexps   []*Regexp
+	templates []string
+	repl      func(pattern int, match string) string
+}
+
+// NewReplacer returns a Replacer replacing the matches of each pattern of set
+// with the template at the same index of templates. Inside a template, $
+// signs are interpreted as in Regexp.Expand with the submatches of the
+// pattern. It returns an error if there is not exactly one template for each
+// pattern, or if a pattern cannot be compiled on its own to locate its
+// matches.
+func NewReplacer(set *Set, templates []string) (*Replacer, error) {
+	if len(templates) != len(set.exprs) {
+		return nil, fmt.Errorf("regexp: %d replacement templates for %d patterns", len(templates), len(set.exprs))
+	}
+	return newReplacer(&Replacer{
+		set:       set,
+		templates: templates,
+	})
+}
+
+// NewReplacerFunc returns a Replacer replacing the matches of set with the
+// return value of repl applied to the index of the matched pattern and the
+// matched text. The replacement returned by repl is substituted directly,
+// without using Regexp.Expand. It returns an error if a pattern cannot be
+// compiled on its own to locate its matches.
+func NewReplacerFunc(set *Set, repl func(pattern int, match string) string) (*Replacer, error) {
+	return newReplacer(&Replacer{
+		set:  set,
+		repl: repl,
+	})
+}
+
+func newReplacer(r *Replacer) (*Replacer, error) {
+	r.regexps = make([]*Regexp, len(r.set.exprs))
+	for i := range r.regexps {
+		re, err := r.set.regexp(i)
+		if err != nil {
+			return nil, err
+		}
+		r.regexps[i] = re
+	}
+	return r, nil
+}
+
+// Replace returns a copy of src with the matches of the patterns replaced,
+// along with the location of each replaced match in src, ordered by position.
+// The Index of each SetMatch is the start and end of the match.
+func (r *Replacer) Replace(src []byte) ([]byte, []SetMatch) {
+	if src == nil {
+		// Keep src non-nil to distinguish it from string input.
+		src = []byte{}
+	}
+	return r.replace(src, "")
+}
+
+// ReplaceString is like Replace but replaces the matches in the string s.
+func (r *Replacer) ReplaceString(s string) (string, []SetMatch) {
+	b, matches := r.replace(nil, s)
+	if matches == nil {
+		return s, nil
+	}
+	return string(b), matches
+}
+
+// replacerCandidate tracks the next match of a pattern reported by the set.
+type replacerCandidate struct {
+	pattern int
+	re      *Regexp
+	nmatch  int
+
+	// match is the next match at or after the search position, or nil if it
+	// needs to be searched for.
+	match []int
+	done  bool
+}
+
+func (r *Replacer) replace(bsrc []byte, src string) ([]byte, []SetMatch) {
+	set := r.set
+	alloc := set.abi.startOperation(len(bsrc) + len(src) + 8*len(set.exprs))
+	defer set.abi.endOperation(alloc)
+
+	// The input is copied once and shared by the set and all the patterns.
+	cs := newIterCString(&alloc, bsrc, src)
+
+	patterns := set.appendMatches(&alloc, cs, len(set.exprs), nil)
+	if len(patterns) == 0 {
+		return appendText(nil, bsrc, src, 0, cs.length), nil
+	}
+	sort.Ints(patterns)
+
+	cands := make([]replacerCandidate, len(patterns))
+	maxMatch := 1
+	for i, p := range patterns {
+		re := r.regexps[p]
+		nmatch := 1
+		if r.repl == nil && strings.Contains(r.templates[p], "$") {
+			nmatch = re.numMatches
+		}
+		cands[i] = replacerCandidate{pattern: p, re: re, nmatch: nmatch}
+		maxMatch = max(maxMatch, nmatch)
+	}
+
+	matchAlloc := set.abi.startOperation(8 * maxMatch)
+	defer set.abi.endOperation(matchAlloc)
+
+	matchArr := matchAlloc.newCStringArray(maxMatch)
+	defer matchArr.free()
+
+	pos := 0
+	prevMatchEnd := -1
+	// search finds the first match of c at or after pos, other than an empty
+	// match right after the previous replaced match.
+	search := func(c *replacerCandidate) {
+		c.match = nil
+		from := pos
+		for from <= cs.length {
+			var matched bool
+			if set.anchor != Unanchored {
+				// An anchored pattern can only match at the start of the input.
+				matched = from == 0 && match(c.re, cs, set.anchor, matchArr.ptr, uint32(c.nmatch))
+			} else {
+				matched = matchFrom(c.re, cs, from, matchArr.ptr, uint32(c.nmatch))
+			}
+			if !matched {
+				break
+			}
+
+			m := make([]int, 0, 2*c.nmatch)
+			readMatches(&matchAlloc, cs, matchArr.ptr, c.nmatch, func(match []int) bool {
+				m = append(m, match...)
+				return true
+			})
+			if m[0] == m[1] && m[0] == prevMatchEnd {
+				from = nextPos(bsrc, src, from, m[1])
+				continue
+			}
+			c.match = m
+			return
+		}
+		c.done = true
+	}
+
+	var dst []byte
+	var matches []SetMatch
+	last := 0
+	for {
+		var best *replacerCandidate
+		for i := range cands {
+			c := &cands[i]
+			if c.done {
+				continue
+			}
+			if c.match == nil || c.match[0] < pos || (c.match[0] == c.match[1] && c.match[0] == prevMatchEnd) {
+				search(c)
+				if c.done {
+					continue
+				}
+			}
+			if best == nil || c.match[0] < best.match[0] {
+				best = c
+			}
+		}
+		if best == nil {
+			break
+		}
+
+		m := best.match
+		dst = appendText(dst, bsrc, src, last, m[0])
+		if r.repl != nil {
+			var matched string
+			if bsrc != nil {
+				matched = string(bsrc[m[0]:m[1]])
+			} else {
+				matched = src[m[0]:m[1]]
+			}
+			dst = append(dst, r.repl(best.pattern, matched)...)
+		} else {
+			dst = best.re.expand(dst, r.templates[best.pattern], bsrc, src, m)
+		}
+		matches = append(matches, SetMatch{Pattern: best.pattern, Index: []int{m[0], m[1]}})
+
+		last = m[1]
+		prevMatchEnd = m[1]
+		pos = nextPos(bsrc, src, m[0], m[1])
+	}
+	dst = appendText(dst, bsrc, src, last, cs.length)
+
+	runtime.KeepAlive(matchArr)
+	runtime.KeepAlive(cands)
+	runtime.KeepAlive(bsrc)
+	runtime.KeepAlive(set) // don't allow finalizer to run during method
+	return dst, matches
+}
+
+// appendText appends the text between start and end of bsrc if it is
+// non-nil, otherwise of src, to dst.
+func appendText(dst []byte, bsrc []byte, src string, start, end int) []byte {
+	if bsrc != nil {
+		return append(dst, bsrc[start:end]...)
+	}
+	return append(dst, src[start:end]...)
+}
@@ -0,0 +1,262 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"slices"
+	"strings"
+)
+
+// The messages are those of RE2::CheckRewriteString.
+const (
+	rewriteTrailingBackslash = `Rewrite schema error: '\' not allowed at end.`
+	rewriteInvalidEscape     = `Rewrite schema error: '\' must be followed by a digit or '\'.`
+)
+
+func rewriteError(msg string) error {
+	return errors.New("regexp: " + msg)
+}
+
+// Extract returns the rewrite template with the submatches of the leftmost
+// match of re in text substituted, ignoring the rest of text. The template
+// uses the syntax of RE2, rather than Expand: \0 refers to the whole match,
+// \1 through \9 to the submatches, and \\ is a literal backslash. ok is false
+// if there is no match or the rewrite is invalid, as reported by CheckRewrite.
+func (re *Regexp) Extract(text, rewrite string) (string, bool) {
+	if !hasRewrite(re.abi) {
+		return re.extractMatched(text, rewrite)
+	}
+	alloc := re.abi.startOperation(len(text) + len(rewrite) + 2)
+	defer re.abi.endOperation(alloc)
+
+	res, ok := extractRewrite(re, alloc.newCString(text), alloc.newCString(rewrite))
+	runtime.KeepAlive(text)
+	runtime.KeepAlive(rewrite)
+	runtime.KeepAlive(re) // don't allow finalizer to run during method
+	return res, ok
+}
+
+// extractMatched is Extract for the Wasm library, which does not export
+// cre2_extract_re, substituting the submatches of a match like RE2::Extract.
+func (re *Regexp) extractMatched(text, rewrite string) (string, bool) {
+	if maxRewriteSubmatch(rewrite) >= re.numMatches {
+		return "", false
+	}
+	match := re.FindStringSubmatchIndex(text)
+	if match == nil {
+		return "", false
+	}
+	res, ok := appendRewrite(nil, rewrite, text, match)
+	if !ok {
+		return "", false
+	}
+	return string(res), true
+}
+
+// CheckRewrite returns an error if rewrite is not a valid RE2 rewrite
+// template for re, because it has invalid escapes or refers to more
+// submatches than re has. A nil error guarantees that Extract does not fail
+// because of the template.
+func (re *Regexp) CheckRewrite(rewrite string) error {
+	if !hasRewrite(re.abi) {
+		return re.checkRewriteString(rewrite)
+	}
+	alloc := re.abi.startOperation(len(rewrite) + 2)
+	defer re.abi.endOperation(alloc)
+
+	msg, ok := checkRewrite(re, alloc.newCString(rewrite))
+	runtime.KeepAlive(rewrite)
+	runtime.KeepAlive(re) // don't allow finalizer to run during method
+	if !ok {
+		return rewriteError(msg)
+	}
+	return nil
+}
+
+// checkRewriteString is CheckRewrite for the Wasm library, which does not
+// export cre2_check_rewrite_string, with the checks of
+// RE2::CheckRewriteString.
+func (re *Regexp) checkRewriteString(rewrite string) error {
+	maxToken := -1
+	for i := 0; i < len(rewrite); i++ {
+		if rewrite[i] != '\\' {
+			continue
+		}
+		i++
+		if i == len(rewrite) {
+			return rewriteError(rewriteTrailingBackslash)
+		}
+		c := rewrite[i]
+		if c == '\\' {
+			continue
+		}
+		if c < '0' || c > '9' {
+			return rewriteError(rewriteInvalidEscape)
+		}
+		if n := int(c - '0'); n > maxToken {
+			maxToken = n
+		}
+	}
+
+	if groups := re.numMatches - 1; maxToken > groups {
+		return rewriteError(fmt.Sprintf("Rewrite schema requests %d matches, but the regexp only has %d parenthesized subexpressions.", maxToken, groups))
+	}
+	return nil
+}
+
+// maxRewriteSubmatch returns the largest submatch referred to by rewrite, or
+// -1 if there is none.
+func maxRewriteSubmatch(rewrite string) int {
+	res := -1
+	for i := 0; i < len(rewrite); i++ {
+		if rewrite[i] != '\\' {
+			continue
+		}
+		i++
+		if i == len(rewrite) {
+			break
+		}
+		if c := rewrite[i]; c >= '0' && c <= '9' {
+			if n := int(c - '0'); n > res {
+				res = n
+			}
+		}
+	}
+	return res
+}
+
+// appendRewrite appends rewrite to dst with the submatches of src located by
+// match substituted, returning false if rewrite is invalid.
+func appendRewrite(dst []byte, rewrite string, src string, match []int) ([]byte, bool) {
+	for i := 0; i < len(rewrite); i++ {
+		c := rewrite[i]
+		if c != '\\' {
+			dst = append(dst, c)
+			continue
+		}
+		i++
+		if i == len(rewrite) {
+			return dst, false
+		}
+		c = rewrite[i]
+		switch {
+		case c == '\\':
+			dst = append(dst, '\\')
+		case c >= '0' && c <= '9':
+			n := int(c - '0')
+			if 2*n+1 >= len(match) {
+				return dst, false
+			}
+			if match[2*n] >= 0 {
+				dst = append(dst, src[match[2*n]:match[2*n+1]]...)
+			}
+		default:
+			return dst, false
+		}
+	}
+	return dst, true
+}
+
+// nativeRewrite returns the RE2 rewrite to replace matches of re with repl,
+// which is a template unless literal is set, if re2 can do the replacement
+// itself. Otherwise the replacement must be done by matching, which is always
+// the case with the Wasm library.
+func (re *Regexp) nativeRewrite(repl string, literal bool) (string, bool) {
+	if !hasGlobalReplace(re.abi) {
+		return "", false
+	}
+	if re.opts.Latin1 {
+		// re2 advances past empty matches a byte at a time, while the input is
+		// advanced a UTF-8 rune at a time when matching.
+		return "", false
+	}
+	if literal {
+		return literalRewrite(repl), true
+	}
+	return re.templateRewrite(repl)
+}
+
+// templateRewrite translates an Expand template into the equivalent RE2
+// rewrite, returning false if there is none because the template refers to a
+// submatch after \9 or to a name shared by several submatches.
+func (re *Regexp) templateRewrite(template string) (string, bool) {
+	var b strings.Builder
+	for len(template) > 0 {
+		before, after, ok := strings.Cut(template, "$")
+		writeLiteralRewrite(&b, before)
+		if !ok {
+			break
+		}
+		template = after
+		if template != "" && template[0] == '$' {
+			// Treat $$ as $.
+			b.WriteByte('$')
+			template = template[1:]
+			continue
+		}
+		name, num, rest, ok := extract(template)
+		if !ok {
+			// Malformed; treat $ as raw text.
+			b.WriteByte('$')
+			continue
+		}
+		template = rest
+		if num < 0 {
+			names := re.SubexpNames()
+			num = slices.Index(names, name)
+			if num >= 0 && slices.Contains(names[num+1:], name) {
+				// Refers to whichever of the submatches participated in the
+				// match.
+				return "", false
+			}
+		}
+		if num < 0 || num >= re.numMatches {
+			// Expands to nothing.
+			continue
+		}
+		if num > 9 {
+			return "", false
+		}
+		b.WriteByte('\\')
+		b.WriteByte(byte('0' + num))
+	}
+	return b.String(), true
+}
+
+// literalRewrite returns the RE2 rewrite inserting s without substitutions.
+func literalRewrite(s string) string {
+	var b strings.Builder
+	writeLiteralRewrite(&b, s)
+	return b.String()
+}
+
+func writeLiteralRewrite(b *strings.Builder, s string) {
+	for {
+		before, after, ok := strings.Cut(s, `\`)
+		b.WriteString(before)
+		if !ok {
+			return
+		}
+		b.WriteString(`\\`)
+		s = after
+	}
+}
+
+// globalReplace replaces all matches in cs with rewrite within re2, avoiding
+// a call into re2 for each match. It returns false if the library does not
+// support it, in which case the replacement must be done by matching.
+func (re *Regexp) globalReplace(alloc *allocation, cs cString, rewrite string) ([]byte, bool) {
+	rcs := alloc.newCString(rewrite)
+	res, ok := globalReplace(re, alloc, cs, rcs)
+	runtime.KeepAlive(rewrite)
+	runtime.KeepAlive(re) // don't allow finalizer to run during method
+	if !ok {
+		return nil, false
+	}
+	if len(res) == 0 {
+		// Match replaceAll, which never appends to its nil buffer.
+		return nil, true
+	}
+	return res, true
+}
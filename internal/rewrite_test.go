@@ -0,0 +1,60 @@
+//go:build re2_cgo
+
+package internal
+
+import "testing"
+
+// The Wasm library substitutes rewrites in Go, which must agree with cre2.
+func TestRewriteMatchesCre2(t *testing.T) {
+	patterns := []struct {
+		expr string
+		opts CompileOptions
+	}{
+		{expr: `a`},
+		{expr: `(a)(b)?`},
+		{expr: `(.*)@([^.]*)`},
+		{expr: `(a)|(b)|(c)(d)(e)(f)(g)(h)(i)(j)`},
+		{expr: `(?P<name>x*)`},
+		{expr: `(a+)(a*)`, opts: CompileOptions{Longest: true}},
+		{expr: "(\xe9)", opts: CompileOptions{Latin1: true}},
+	}
+	texts := []string{"", "a", "ab", "b", "boris@kremvax.ru", "xxaab", "cdefghij", "\xe9", "\xff"}
+
+	// Every rewrite of up to three runes of interest, along with longer ones.
+	var rewrites []string
+	pieces := []string{`\`, `0`, `1`, `2`, `9`, `a`, `$`, `\1`, `\\`}
+	var gen func(prefix string, n int)
+	gen = func(prefix string, n int) {
+		rewrites = append(rewrites, prefix)
+		if n == 0 {
+			return
+		}
+		for _, p := range pieces {
+			gen(prefix+p, n-1)
+		}
+	}
+	gen("", 3)
+	rewrites = append(rewrites, `\2!\1`, `<\0>`, `[\1][\2]`, `\9\8\7`, `\\\1\\`, `x\`)
+
+	for _, p := range patterns {
+		re, err := Compile(p.expr, p.opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, rewrite := range rewrites {
+			wantErr := re.CheckRewrite(rewrite)
+			gotErr := re.checkRewriteString(rewrite)
+			if (gotErr == nil) != (wantErr == nil) || (gotErr != nil && gotErr.Error() != wantErr.Error()) {
+				t.Errorf("%#q: checkRewriteString(%#q) = %v, want %v", p.expr, rewrite, gotErr, wantErr)
+			}
+			for _, text := range texts {
+				want, wantOK := re.Extract(text, rewrite)
+				got, gotOK := re.extractMatched(text, rewrite)
+				if got != want || gotOK != wantOK {
+					t.Errorf("%#q: extractMatched(%q, %#q) = %q, %v, want %q, %v", p.expr, text, rewrite, got, gotOK, want, wantOK)
+				}
+			}
+		}
+		re.Close()
+	}
+}
@@ -2,29 +2,79 @@ package internal
 
 import (
 	"encoding/binary"
+	"errors"
 	"fmt"
+	"regexp"
+	"regexp/syntax"
 	"runtime"
+	"sort"
+	"strings"
+	"sync"
 	"sync/atomic"
 )
 
 const unknownCompileError = "unknown error compiling pattern"
 
+// ErrSetOutOfMemory is returned when matching a Set fails because RE2 ran out
+// of memory for the DFA, in which case it is unknown whether any pattern matched.
+// Increasing MaxMem in the options used to compile the Set may help.
+var ErrSetOutOfMemory = errors.New("re2: set match ran out of memory")
+
+// RE2::Set::ErrorKind, negated in the result of a failed match.
+const (
+	setErrorNotCompiled = 1
+	setErrorOutOfMemory = 2
+)
+
 type Set struct {
 	ptr      wasmPtr
 	abi      *libre2ABI
 	opts     CompileOptions
+	anchor   Anchor
 	exprs    []string
 	released uint32
+	// closeMu is held for reading while the set is used, and for writing to
+	// free it.
+	closeMu sync.RWMutex
+
+	// regexps are the individual patterns, compiled on first use to locate
+	// the matches reported by the set.
+	regexps   []*Regexp
+	regexpsMu sync.Mutex
+
+	// alternate matches any of the patterns, compiled on first use to
+	// confirm that nothing matched when the set can't report failures and to
+	// find the matches continuing past a chunk searched by FindAllContext.
+	alternate     *Regexp
+	alternateOnce sync.Once
+
+	// contextFree reports for each pattern whether it has no empty-width
+	// assertions, so FindAllContext can search for it in chunks of the input.
+	contextFree     []bool
+	contextFreeOnce sync.Once
 }
 
-func CompileSet(exprs []string, opts CompileOptions) (*Set, error) {
+// SetMatch is the location of a match of a single pattern in a Set.
+type SetMatch struct {
+	// Pattern is the index of the matched pattern in the Set.
+	Pattern int
+	// Index is the location of the match, in the same form as returned by
+	// Regexp.FindIndex or, for the submatch methods, Regexp.FindSubmatchIndex.
+	Index []int
+}
+
+func CompileSet(exprs []string, opts CompileOptions, anchor Anchor) (*Set, error) {
 	abi := newABI()
-	setPtr := newSet(abi, opts)
+	if err := checkOptions(abi, opts); err != nil {
+		return nil, err
+	}
+	setPtr := newSet(abi, opts, anchor)
 	set := &Set{
-		ptr:   setPtr,
-		abi:   abi,
-		opts:  opts,
-		exprs: exprs,
+		ptr:    setPtr,
+		abi:    abi,
+		opts:   opts,
+		anchor: anchor,
+		exprs:  exprs,
 	}
 	var estimatedMemorySize int
 	for _, expr := range exprs {
@@ -34,14 +84,19 @@ func CompileSet(exprs []string, opts CompileOptions) (*Set, error) {
 	alloc := abi.startOperation(estimatedMemorySize)
 	defer abi.endOperation(alloc)
 
-	for _, expr := range exprs {
+	for i, expr := range exprs {
 		cs := alloc.newCString(expr)
 		errMsg := setAdd(set, cs)
 		if errMsg != "" {
-			return nil, fmt.Errorf("%s", errMsg)
+			deleteSet(abi, setPtr)
+			return nil, setCompileError(i, expr, errMsg, opts)
 		}
 	}
-	setCompile(set)
+	if setCompile(set) == 0 {
+		// RE2 ran out of memory compiling the patterns into a single program.
+		deleteSet(abi, setPtr)
+		return nil, newError(syntax.ErrLarge, "error parsing regexp: expression too large", -1, "")
+	}
 	// Use func(interface{}) form for nottinygc compatibility.
 	runtime.SetFinalizer(set, func(obj interface{}) {
 		if s, ok := obj.(*Set); ok {
@@ -51,11 +106,64 @@ func CompileSet(exprs []string, opts CompileOptions) (*Set, error) {
 	return set, nil
 }
 
+// setCompileError returns the error for an expression rejected by the set. re2
+// only reports a message when adding to a set, so the details come from compiling
+// the expression on its own.
+func setCompileError(idx int, expr string, msg string, opts CompileOptions) error {
+	e := &Error{Code: syntax.ErrInternalError, Offset: -1, msg: msg}
+	re, err := Compile(expr, opts)
+	var reErr *Error
+	switch {
+	case err == nil:
+		re.release()
+	case errors.As(err, &reErr):
+		e.Code, e.Expr, e.Offset = reErr.Code, reErr.Expr, reErr.Offset
+	}
+	return &SetError{Index: idx, Err: e}
+}
+
+// Close frees the memory held by the Set without waiting for it to be garbage
+// collected, as with Regexp.Close. Close waits for matches already using the
+// Set to return, and methods matching with the Set panic once it is closed.
+// Calling Close more than once has no effect.
+func (set *Set) Close() {
+	set.release()
+}
+
+// enter panics if set was closed, and otherwise keeps Close from freeing it
+// until leave is called, while it is used for matching.
+func (set *Set) enter() {
+	set.closeMu.RLock()
+	if atomic.LoadUint32(&set.released) != 0 {
+		set.closeMu.RUnlock()
+		panic("re2: use of closed Set")
+	}
+}
+
+func (set *Set) leave() {
+	set.closeMu.RUnlock()
+}
+
 func (set *Set) release() {
+	// Wait for matches using the set to return.
+	set.closeMu.Lock()
 	if !atomic.CompareAndSwapUint32(&set.released, 0, 1) {
+		set.closeMu.Unlock()
 		return
 	}
 	deleteSet(set.abi, set.ptr)
+	set.closeMu.Unlock()
+
+	set.regexpsMu.Lock()
+	defer set.regexpsMu.Unlock()
+	for _, re := range set.regexps {
+		if re != nil {
+			re.release()
+		}
+	}
+	if set.alternate != nil {
+		set.alternate.release()
+	}
 }
 
 // FindAllString finds all matches of the regular expressions in the Set against the input string.
@@ -72,11 +180,7 @@ func (set *Set) FindAllString(s string, n int) []int {
 
 	cs := alloc.newCString(s)
 
-	var matches []int
-
-	set.findAll(&alloc, cs, n, func(match int) {
-		matches = append(matches, match)
-	})
+	matches := set.appendMatches(&alloc, cs, n, nil)
 	return matches
 }
 
@@ -95,25 +199,375 @@ func (set *Set) FindAll(b []byte, n int) []int {
 
 	cs := alloc.newCStringFromBytes(b)
 
-	var matches []int
-
-	set.findAll(&alloc, cs, n, func(match int) {
-		matches = append(matches, match)
-	})
+	matches := set.appendMatches(&alloc, cs, n, nil)
 
 	return matches
 }
 
-func (set *Set) findAll(alloc *allocation, cs cString, n int, deliver func(match int)) {
+// Match reports whether any of the regular expressions in the Set match the
+// input bytes, without collecting the indices of the matching patterns.
+func (set *Set) Match(b []byte) bool {
+	alloc := set.abi.startOperation(len(b))
+	defer set.abi.endOperation(alloc)
+
+	cs := alloc.newCStringFromBytes(b)
+
+	res := setMatch(set, cs, nilWasmPtr, 0) > 0
+	runtime.KeepAlive(b)
+	runtime.KeepAlive(set) // don't allow finalizer to run during method
+	return res
+}
+
+// MatchString reports whether any of the regular expressions in the Set
+// match the input string.
+func (set *Set) MatchString(s string) bool {
+	alloc := set.abi.startOperation(len(s))
+	defer set.abi.endOperation(alloc)
+
+	cs := alloc.newCString(s)
+
+	res := setMatch(set, cs, nilWasmPtr, 0) > 0
+	runtime.KeepAlive(s)
+	runtime.KeepAlive(set) // don't allow finalizer to run during method
+	return res
+}
+
+// AppendMatches appends the indices of all the patterns in the Set matching
+// the input bytes to dst and returns the extended slice. Reusing dst across
+// calls allows scanning without allocating.
+func (set *Set) AppendMatches(dst []int, b []byte) []int {
+	n := len(set.exprs)
+	alloc := set.abi.startOperation(len(b) + 8 + n*8)
+	defer set.abi.endOperation(alloc)
+
+	cs := alloc.newCStringFromBytes(b)
+
+	dst = set.appendMatches(&alloc, cs, n, dst)
+	runtime.KeepAlive(b)
+	return dst
+}
+
+// AppendMatchesString is like AppendMatches but matches against the input string.
+func (set *Set) AppendMatchesString(dst []int, s string) []int {
+	n := len(set.exprs)
+	alloc := set.abi.startOperation(len(s) + 8 + n*8)
+	defer set.abi.endOperation(alloc)
+
+	cs := alloc.newCString(s)
+
+	dst = set.appendMatches(&alloc, cs, n, dst)
+	runtime.KeepAlive(s)
+	return dst
+}
+
+// FindAllE is like FindAll but returns an error if the match failed, rather
+// than reporting no matches. In particular, ErrSetOutOfMemory is returned if
+// the DFA ran out of memory. The Wasm library can't report failed matches, so
+// with the default and wazero builds a result with no matches is confirmed by
+// searching for all the patterns with a single Regexp, which costs a second
+// search of the input.
+func (set *Set) FindAllE(b []byte, n int) ([]int, error) {
+	if n == 0 {
+		return nil, nil
+	}
+	if n < 0 {
+		n = len(set.exprs)
+	}
+	alloc := set.abi.startOperation(len(b) + 8 + n*8)
+	defer set.abi.endOperation(alloc)
+
+	cs := alloc.newCStringFromBytes(b)
+
+	res, err := set.findAllChecked(&alloc, cs, n)
+	runtime.KeepAlive(b)
+	return res, err
+}
+
+// FindAllStringE is like FindAllString but returns an error if the match
+// failed, rather than reporting no matches.
+func (set *Set) FindAllStringE(s string, n int) ([]int, error) {
+	if n == 0 {
+		return nil, nil
+	}
+	if n < 0 {
+		n = len(set.exprs)
+	}
+	alloc := set.abi.startOperation(len(s) + 8 + n*8)
+	defer set.abi.endOperation(alloc)
+
+	cs := alloc.newCString(s)
+
+	res, err := set.findAllChecked(&alloc, cs, n)
+	runtime.KeepAlive(s)
+	return res, err
+}
+
+func (set *Set) findAllChecked(alloc *allocation, cs cString, n int) ([]int, error) {
+	matchArr := alloc.newCStringArray(n)
+	defer matchArr.free()
+
+	matchedCount := setMatchChecked(set, cs, matchArr.ptr, n)
+	switch {
+	case matchedCount == -setErrorOutOfMemory:
+		return nil, ErrSetOutOfMemory
+	case matchedCount == -setErrorNotCompiled:
+		return nil, errors.New("re2: set match on set that failed to compile")
+	case matchedCount < 0:
+		return nil, fmt.Errorf("re2: set match failed with error kind %d", -matchedCount)
+	}
+
+	var dst []int
+	matches := alloc.read(matchArr.ptr, n*4)
+	for i := 0; i < matchedCount && i < n; i++ {
+		dst = append(dst, int(binary.LittleEndian.Uint32(matches[i*4:])))
+	}
+
+	runtime.KeepAlive(matchArr)
+	runtime.KeepAlive(set) // don't allow finalizer to run during method
+	return dst, nil
+}
+
+func (set *Set) appendMatches(alloc *allocation, cs cString, n int, dst []int) []int {
 	matchArr := alloc.newCStringArray(n)
 	defer matchArr.free()
 
 	matchedCount := setMatch(set, cs, matchArr.ptr, n)
 	matches := alloc.read(matchArr.ptr, n*4)
 	for i := 0; i < matchedCount && i < n; i++ {
-		deliver(int(binary.LittleEndian.Uint32(matches[i*4:])))
+		dst = append(dst, int(binary.LittleEndian.Uint32(matches[i*4:])))
 	}
 
 	runtime.KeepAlive(matchArr)
 	runtime.KeepAlive(set) // don't allow finalizer to run during method
+	return dst
+}
+
+// mayMatch reports whether any of the patterns matches cs, using a Regexp
+// which falls back to the NFA when the DFA runs out of memory rather than
+// failing as the set does. It also returns true if the Regexp could not be
+// compiled, so a failed set match is never taken for no match.
+func (set *Set) mayMatch(cs cString) bool {
+	if len(set.exprs) == 0 {
+		return false
+	}
+	alternate := set.alternation()
+	if alternate == nil {
+		return true
+	}
+	res := match(alternate, cs, set.anchor, nilWasmPtr, 0)
+	runtime.KeepAlive(set) // don't allow finalizer to run during method
+	return res
+}
+
+// alternation returns a Regexp matching any of the patterns, compiled on
+// first use, or nil if it could not be compiled.
+func (set *Set) alternation() *Regexp {
+	set.alternateOnce.Do(func() {
+		set.alternate = compileAlternate(set.exprs, set.opts)
+	})
+	return set.alternate
+}
+
+// contextFreePatterns returns whether each pattern has no empty-width
+// assertions.
+func (set *Set) contextFreePatterns() []bool {
+	set.contextFreeOnce.Do(func() {
+		set.contextFree = make([]bool, len(set.exprs))
+		for i, expr := range set.exprs {
+			set.contextFree[i] = !hasAssertion(expr, set.opts)
+		}
+	})
+	return set.contextFree
+}
+
+// compileAlternate compiles an expression matching any of exprs, or returns
+// nil if it can't be compiled.
+func compileAlternate(exprs []string, opts CompileOptions) *Regexp {
+	var sb strings.Builder
+	for i, expr := range exprs {
+		if i > 0 {
+			sb.WriteByte('|')
+		}
+		if opts.Literal {
+			expr = regexp.QuoteMeta(expr)
+		}
+		// Capturing groups are also valid with POSIX syntax.
+		sb.WriteString("(" + expr + ")")
+	}
+	opts.Literal = false
+	opts.MaxProgramSize = 0
+	re, err := Compile(sb.String(), opts)
+	if err != nil {
+		return nil
+	}
+	return re
+}
+
+// FindAllIndex is like FindAll but also returns the location of the leftmost
+// match of each matched pattern, ordered by pattern index. Only the patterns
+// reported by the Set are searched again to find their location. A pattern
+// which fails to compile on its own to be located is left out, which
+// FindAllIndexE reports as an error instead.
+func (set *Set) FindAllIndex(b []byte, n int) []SetMatch {
+	matches, _ := set.locate(set.FindAll(b, n), b, "", false)
+	return matches
+}
+
+// FindAllStringIndex is like FindAllString but also returns the location of
+// the leftmost match of each matched pattern.
+func (set *Set) FindAllStringIndex(s string, n int) []SetMatch {
+	matches, _ := set.locate(set.FindAllString(s, n), nil, s, false)
+	return matches
+}
+
+// FindAllSubmatchIndex is like FindAllIndex but the location of each match
+// also includes its submatches, as returned by Regexp.FindSubmatchIndex.
+func (set *Set) FindAllSubmatchIndex(b []byte, n int) []SetMatch {
+	matches, _ := set.locate(set.FindAll(b, n), b, "", true)
+	return matches
+}
+
+// FindAllStringSubmatchIndex is like FindAllStringIndex but the location of
+// each match also includes its submatches.
+func (set *Set) FindAllStringSubmatchIndex(s string, n int) []SetMatch {
+	matches, _ := set.locate(set.FindAllString(s, n), nil, s, true)
+	return matches
+}
+
+// FindAllIndexE is like FindAllIndex but returns an error if the match failed,
+// as FindAllE does, or a *SetError if a matched pattern failed to compile on
+// its own, rather than leaving it out.
+func (set *Set) FindAllIndexE(b []byte, n int) ([]SetMatch, error) {
+	patterns, err := set.FindAllE(b, n)
+	if err != nil {
+		return nil, err
+	}
+	return set.locateE(patterns, b, "", false)
+}
+
+// FindAllStringIndexE is like FindAllStringIndex but returns an error as
+// FindAllIndexE does.
+func (set *Set) FindAllStringIndexE(s string, n int) ([]SetMatch, error) {
+	patterns, err := set.FindAllStringE(s, n)
+	if err != nil {
+		return nil, err
+	}
+	return set.locateE(patterns, nil, s, false)
+}
+
+// FindAllSubmatchIndexE is like FindAllSubmatchIndex but returns an error as
+// FindAllIndexE does.
+func (set *Set) FindAllSubmatchIndexE(b []byte, n int) ([]SetMatch, error) {
+	patterns, err := set.FindAllE(b, n)
+	if err != nil {
+		return nil, err
+	}
+	return set.locateE(patterns, b, "", true)
+}
+
+// FindAllStringSubmatchIndexE is like FindAllStringSubmatchIndex but returns
+// an error as FindAllIndexE does.
+func (set *Set) FindAllStringSubmatchIndexE(s string, n int) ([]SetMatch, error) {
+	patterns, err := set.FindAllStringE(s, n)
+	if err != nil {
+		return nil, err
+	}
+	return set.locateE(patterns, nil, s, true)
+}
+
+// locateE is like locate but returns no matches along with an error.
+func (set *Set) locateE(patterns []int, bsrc []byte, src string, submatch bool) ([]SetMatch, error) {
+	matches, err := set.locate(patterns, bsrc, src, submatch)
+	if err != nil {
+		return nil, err
+	}
+	return matches, nil
+}
+
+// locate returns the location of the matches of patterns, leaving out those
+// which fail to compile on their own, along with the first such error.
+func (set *Set) locate(patterns []int, bsrc []byte, src string, submatch bool) ([]SetMatch, error) {
+	if len(patterns) == 0 {
+		return nil, nil
+	}
+	sort.Ints(patterns)
+
+	var firstErr error
+	regexps := make([]*Regexp, 0, len(patterns))
+	located := patterns[:0]
+	size := len(bsrc) + len(src)
+	for _, p := range patterns {
+		re, err := set.regexp(p)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = &SetError{Index: p, Err: err}
+			}
+			continue
+		}
+		regexps = append(regexps, re)
+		located = append(located, p)
+		if submatch {
+			size += 8 * re.numMatches
+		} else {
+			size += 8
+		}
+	}
+
+	alloc := set.abi.startOperation(size)
+	defer set.abi.endOperation(alloc)
+
+	var cs cString
+	if bsrc != nil {
+		cs = alloc.newCStringFromBytes(bsrc)
+	} else {
+		cs = alloc.newCString(src)
+	}
+
+	matches := make([]SetMatch, 0, len(patterns))
+	for i, re := range regexps {
+		nmatch := 1
+		if submatch {
+			nmatch = re.numMatches
+		}
+		matchArr := alloc.newCStringArray(nmatch)
+		// The set and the pattern agree on what matches, so this only guards
+		// against reading an unset match array.
+		if match(re, cs, set.anchor, matchArr.ptr, uint32(nmatch)) {
+			var index []int
+			readMatches(&alloc, cs, matchArr.ptr, nmatch, func(match []int) bool {
+				index = append(index, match...)
+				return true
+			})
+			matches = append(matches, SetMatch{Pattern: located[i], Index: index})
+		}
+		matchArr.free()
+		runtime.KeepAlive(re)
+	}
+
+	runtime.KeepAlive(bsrc)
+	runtime.KeepAlive(set) // don't allow finalizer to run during method
+	return matches, firstErr
+}
+
+// regexp returns the compiled Regexp for pattern i of the set.
+func (set *Set) regexp(i int) (*Regexp, error) {
+	set.regexpsMu.Lock()
+	defer set.regexpsMu.Unlock()
+
+	if set.regexps == nil {
+		set.regexps = make([]*Regexp, len(set.exprs))
+	}
+	if re := set.regexps[i]; re != nil {
+		return re, nil
+	}
+	// The pattern was already accepted by the set, but MaxProgramSize only
+	// applies to individual expressions and is not enforced for a Set.
+	opts := set.opts
+	opts.MaxProgramSize = 0
+	re, err := Compile(set.exprs[i], opts)
+	if err != nil {
+		return nil, err
+	}
+	set.regexps[i] = re
+	return re, nil
 }
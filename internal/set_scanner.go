@@ -0,0 +1,156 @@
+package internal
+
+import (
+	"errors"
+	"io"
+	"slices"
+)
+
+// defaultScanChunk is the size of the chunks read by SetScanner.ReadFrom.
+const defaultScanChunk = 32 << 10
+
+// SetScanMatch is a match of a pattern of a Set reported by a SetScanner.
+type SetScanMatch struct {
+	// Pattern is the index of the matched pattern in the Set.
+	Pattern int
+	// Offset is the offset in the stream of the start of the window in which
+	// the match was found. The match starts at or after Offset, within the
+	// overlap and the chunk that was scanned.
+	Offset int64
+}
+
+// SetScanner scans a stream with a Set as it is written, in chunks. Each
+// chunk is searched along with up to overlap bytes at the end of the
+// previous chunks, so a match straddling chunks is found as long as it is
+// no longer than overlap plus the chunk containing its end. A match which
+// was already found in a previous window is not reported again.
+//
+// A Set compiled with an anchor only matches at the start of the stream, so
+// it is only searched while the window still begins there. With AnchorBoth,
+// the match must extend to the end of the data written so far. Other
+// assertions, such as ^, $ and word boundaries, are evaluated against the
+// window being scanned, not the whole stream.
+//
+// A SetScanner is not safe for concurrent use.
+type SetScanner struct {
+	set     *Set
+	overlap int
+	report  func(SetScanMatch)
+
+	// buf holds the overlap kept from the previous chunks, followed by the
+	// chunk being scanned.
+	buf []byte
+	// base is the offset in the stream of buf[0].
+	base int64
+
+	matched []int
+	inTail  []int
+}
+
+// NewSetScanner returns a SetScanner searching with set, carrying overlap
+// bytes between chunks and calling report for each match found.
+func NewSetScanner(set *Set, overlap int, report func(SetScanMatch)) *SetScanner {
+	if overlap < 0 {
+		overlap = 0
+	}
+	return &SetScanner{
+		set:     set,
+		overlap: overlap,
+		report:  report,
+	}
+}
+
+// Write scans p as the next chunk of the stream. It always returns len(p)
+// and a nil error.
+func (s *SetScanner) Write(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	tail := len(s.buf)
+	s.buf = append(s.buf, p...)
+	s.scan(tail)
+	s.keepOverlap()
+	return len(p), nil
+}
+
+// ReadFrom scans the data read from r until io.EOF or an error, which is
+// returned. It returns the number of bytes read.
+func (s *SetScanner) ReadFrom(r io.Reader) (int64, error) {
+	var n int64
+	chunk := make([]byte, defaultScanChunk)
+	for {
+		m, err := r.Read(chunk)
+		if m > 0 {
+			n += int64(m)
+			_, _ = s.Write(chunk[:m])
+		}
+		if errors.Is(err, io.EOF) {
+			return n, nil
+		}
+		if err != nil {
+			return n, err
+		}
+	}
+}
+
+// Offset returns the number of bytes of the stream scanned so far.
+func (s *SetScanner) Offset() int64 {
+	return s.base + int64(len(s.buf))
+}
+
+// scan searches buf, where buf[:tail] is the overlap which was already
+// searched as part of the previous window.
+func (s *SetScanner) scan(tail int) {
+	if s.set.anchor != Unanchored && s.base > 0 {
+		// The window no longer begins at the start of the stream, where an
+		// anchored match must start.
+		return
+	}
+	s.matched = s.set.AppendMatches(s.matched[:0], s.buf)
+	if len(s.matched) == 0 {
+		return
+	}
+
+	s.inTail = s.inTail[:0]
+	if tail > 0 {
+		s.inTail = s.set.AppendMatches(s.inTail, s.buf[:tail])
+	}
+
+	for _, p := range s.matched {
+		if slices.Contains(s.inTail, p) && !s.matchesPast(p, tail) {
+			// Only the match in the overlap, already reported.
+			continue
+		}
+		s.report(SetScanMatch{Pattern: p, Offset: s.base})
+	}
+}
+
+// matchesPast reports whether pattern p has a match in buf ending after
+// tail, for a pattern known to also match within buf[:tail].
+func (s *SetScanner) matchesPast(p int, tail int) bool {
+	if s.set.anchor != Unanchored {
+		// An anchored pattern matches at the start of the stream both times.
+		return false
+	}
+	re, err := s.set.regexp(p)
+	if err != nil {
+		// Report the match again rather than risk missing it.
+		return true
+	}
+	for _, loc := range re.FindAllIndex(s.buf, -1) {
+		if loc[1] > tail {
+			return true
+		}
+	}
+	return false
+}
+
+// keepOverlap discards all but the last overlap bytes of buf.
+func (s *SetScanner) keepOverlap() {
+	n := len(s.buf) - s.overlap
+	if n <= 0 {
+		return
+	}
+	s.base += int64(n)
+	s.buf = s.buf[:copy(s.buf, s.buf[n:])]
+}
@@ -0,0 +1,104 @@
+package internal
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestSetMayMatch(t *testing.T) {
+	tests := []struct {
+		name   string
+		exprs  []string
+		opts   CompileOptions
+		anchor Anchor
+		input  string
+		want   bool
+	}{
+		{name: "match", exprs: []string{`a+b`, `c\d`}, input: "xc1", want: true},
+		{name: "no match", exprs: []string{`a+b`, `c\d`}, input: "xc", want: false},
+		{name: "empty set", input: "x", want: false},
+		{name: "flags scoped to pattern", exprs: []string{`(?i)ab`, `c`}, input: "AB", want: true},
+		{name: "flags scoped to pattern no match", exprs: []string{`(?i)ab`, `c`}, input: "C", want: false},
+		{name: "literal", exprs: []string{`a+`, `(b`}, opts: CompileOptions{Literal: true}, input: "x(b", want: true},
+		{name: "literal no match", exprs: []string{`a+`, `(b`}, opts: CompileOptions{Literal: true}, input: "aa", want: false},
+		{name: "posix", exprs: []string{`a+`, `b`}, opts: CompileOptions{Posix: true}, input: "xb", want: true},
+		{name: "anchor start", exprs: []string{`a`, `b`}, anchor: AnchorStart, input: "xb", want: false},
+		{name: "anchor both", exprs: []string{`a`, `b+`}, anchor: AnchorBoth, input: "bb", want: true},
+		{name: "anchor both no match", exprs: []string{`a`, `b`}, anchor: AnchorBoth, input: "bb", want: false},
+	}
+	for _, tc := range tests {
+		tt := tc
+		t.Run(tt.name, func(t *testing.T) {
+			set, err := CompileSet(tt.exprs, tt.opts, tt.anchor)
+			if errors.Is(err, errors.ErrUnsupported) {
+				t.Skip(err)
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer set.Close()
+
+			alloc := set.abi.startOperation(len(tt.input))
+			defer set.abi.endOperation(alloc)
+			cs := alloc.newCString(tt.input)
+
+			if got := set.mayMatch(cs); got != tt.want {
+				t.Errorf("mayMatch(%q) = %v, want %v", tt.input, got, tt.want)
+			}
+			// mayMatch confirms that the set found no match, so they must agree.
+			if got := len(set.FindAllString(tt.input, -1)) > 0; got != tt.want {
+				t.Errorf("FindAllString(%q) matched = %v, want %v", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetMayMatchUncompilable(t *testing.T) {
+	exprs := []string{`a`, `b`}
+	set, err := CompileSet(exprs, CompileOptions{}, Unanchored)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer set.Close()
+	// An alternation that failed to compile can't confirm there was no match.
+	set.alternateOnce.Do(func() {})
+
+	alloc := set.abi.startOperation(1)
+	defer set.abi.endOperation(alloc)
+	if !set.mayMatch(alloc.newCString("x")) {
+		t.Error("mayMatch() = false, want true without a compiled alternation")
+	}
+}
+
+func TestSetLocateUncompilable(t *testing.T) {
+	set, err := CompileSet([]string{`a`, `b+`}, CompileOptions{}, Unanchored)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer set.Close()
+	// Make the second pattern, which the set still matches, fail to compile
+	// on its own.
+	set.exprs = []string{`a`, `b(`}
+
+	matches := set.FindAllStringIndex("ab", -1)
+	if len(matches) != 1 || matches[0].Pattern != 0 {
+		t.Errorf("FindAllStringIndex() = %v, want only pattern 0", matches)
+	}
+
+	matches, err = set.FindAllStringIndexE("ab", -1)
+	var setErr *SetError
+	if !errors.As(err, &setErr) || setErr.Index != 1 {
+		t.Fatalf("FindAllStringIndexE() error = %v, want *SetError for pattern 1", err)
+	}
+	if matches != nil {
+		t.Errorf("FindAllStringIndexE() = %v, want nil with an error", matches)
+	}
+	if _, err := set.FindAllSubmatchIndexE([]byte("ab"), -1); !errors.As(err, &setErr) {
+		t.Errorf("FindAllSubmatchIndexE() error = %v, want *SetError", err)
+	}
+
+	matches, err = set.FindAllStringIndexE("a", -1)
+	if err != nil || len(matches) != 1 || matches[0].Pattern != 0 {
+		t.Errorf("FindAllStringIndexE() = %v, %v, want pattern 0 without an error", matches, err)
+	}
+}
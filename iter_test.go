@@ -0,0 +1,71 @@
+package re2
+
+import (
+	"reflect"
+	"slices"
+	"testing"
+)
+
+func TestAllIndex(t *testing.T) {
+	for _, test := range findTests {
+		re := MustCompile(test.pat)
+		testFindAllIndex(&test, slices.Collect(re.AllIndex([]byte(test.text))), t)
+		testFindAllIndex(&test, slices.Collect(re.AllStringIndex(test.text)), t)
+	}
+}
+
+func TestAllSubmatchIndex(t *testing.T) {
+	for _, test := range findTests {
+		re := MustCompile(test.pat)
+		testFindAllSubmatchIndex(&test, slices.Collect(re.AllSubmatchIndex([]byte(test.text))), t)
+		testFindAllSubmatchIndex(&test, slices.Collect(re.AllStringSubmatchIndex(test.text)), t)
+	}
+}
+
+func TestAll(t *testing.T) {
+	for _, test := range findTests {
+		re := MustCompile(test.pat)
+		if got, want := slices.Collect(re.AllString(test.text)), re.FindAllString(test.text, -1); !reflect.DeepEqual(got, want) {
+			t.Errorf("AllString: got %q, want %q: %s", got, want, test)
+		}
+		if got, want := slices.Collect(re.All([]byte(test.text))), re.FindAll([]byte(test.text), -1); !reflect.DeepEqual(got, want) {
+			t.Errorf("All: got %q, want %q: %s", got, want, test)
+		}
+		if got, want := slices.Collect(re.AllStringSubmatch(test.text)), re.FindAllStringSubmatch(test.text, -1); !reflect.DeepEqual(got, want) {
+			t.Errorf("AllStringSubmatch: got %q, want %q: %s", got, want, test)
+		}
+		if got, want := slices.Collect(re.AllSubmatch([]byte(test.text))), re.FindAllSubmatch([]byte(test.text), -1); !reflect.DeepEqual(got, want) {
+			t.Errorf("AllSubmatch: got %q, want %q: %s", got, want, test)
+		}
+	}
+}
+
+func TestAllBreak(t *testing.T) {
+	re := MustCompile(`a(b*)`)
+	s := "ab abb abbb abbbb"
+
+	var got []string
+	for m := range re.AllString(s) {
+		got = append(got, m)
+		if len(m) == 3 {
+			break
+		}
+	}
+	if want := []string{"ab", "abb"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	var gotIdx [][]int
+	for m := range re.AllSubmatchIndex([]byte(s)) {
+		gotIdx = append(gotIdx, m)
+		break
+	}
+	if want := [][]int{{0, 2, 1, 2}}; !reflect.DeepEqual(gotIdx, want) {
+		t.Errorf("got %v, want %v", gotIdx, want)
+	}
+
+	// The regexp can still be used after breaking out of the iteration.
+	if got := re.FindAllString(s, -1); len(got) != 4 {
+		t.Errorf("FindAllString() = %q, want 4 matches", got)
+	}
+}
@@ -0,0 +1,130 @@
+package re2
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestCompileWithOptions(t *testing.T) {
+	tests := []struct {
+		name    string
+		pattern string
+		opts    Options
+		input   string
+		want    bool
+	}{
+		{name: "default", pattern: `a.b`, input: "axb", want: true},
+		{name: "literal", pattern: `a.b`, opts: Options{Literal: true}, input: "axb", want: false},
+		{name: "literal match", pattern: `a.b`, opts: Options{Literal: true}, input: "xa.bx", want: true},
+		{name: "literal invalid syntax", pattern: `a(b`, opts: Options{Literal: true}, input: "a(b", want: true},
+		{name: "dot nl off", pattern: `a.b`, input: "a\nb", want: false},
+		{name: "dot nl", pattern: `a.b`, opts: Options{DotNL: true}, input: "a\nb", want: true},
+		{name: "never nl literal", pattern: `a\nb`, opts: Options{NeverNL: true}, input: "a\nb", want: false},
+		{name: "never nl class", pattern: `a[^x]b`, opts: Options{NeverNL: true}, input: "a\nb", want: false},
+		{name: "case insensitive", pattern: `abc`, opts: Options{CaseInsensitive: true}, input: "ABC", want: true},
+		{name: "latin1", pattern: `\xac\xed`, opts: Options{Latin1: true}, input: "\xac\xed", want: true},
+		{name: "posix perl classes", pattern: `\d+`, opts: Options{Posix: true, PerlClasses: true}, input: "123", want: true},
+		{name: "posix word boundary", pattern: `\bfoo\b`, opts: Options{Posix: true, WordBoundary: true}, input: "a foo b", want: true},
+		{name: "posix multi line", pattern: `^b`, opts: Options{Posix: true}, input: "a\nb", want: true},
+		{name: "posix one line", pattern: `^b`, opts: Options{Posix: true, OneLine: true}, input: "a\nb", want: false},
+	}
+
+	for _, tc := range tests {
+		tt := tc
+		t.Run(tt.name, func(t *testing.T) {
+			re, err := CompileWithOptions(tt.pattern, tt.opts)
+			if errors.Is(err, errors.ErrUnsupported) {
+				t.Skip(err)
+			}
+			if err != nil {
+				t.Fatalf("CompileWithOptions(%q, %+v): %v", tt.pattern, tt.opts, err)
+			}
+			if got := re.MatchString(tt.input); got != tt.want {
+				t.Errorf("MatchString(%q) = %v, want %v", tt.input, got, tt.want)
+			}
+			if got := re.Options(); got != tt.opts {
+				t.Errorf("Options() = %+v, want %+v", got, tt.opts)
+			}
+		})
+	}
+}
+
+func TestCompileWithOptionsErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		pattern string
+		opts    Options
+	}{
+		{name: "posix without perl classes", pattern: `\d`, opts: Options{Posix: true}},
+		{name: "posix without word boundary", pattern: `\b`, opts: Options{Posix: true}},
+		{name: "max mem", pattern: strings.Repeat(`[a-z]{100}`, 10), opts: Options{MaxMem: 1024}},
+	}
+
+	for _, tc := range tests {
+		tt := tc
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := CompileWithOptions(tt.pattern, tt.opts); err == nil {
+				t.Errorf("CompileWithOptions(%q, %+v): missing error", tt.pattern, tt.opts)
+			}
+		})
+	}
+}
+
+func TestCompileWithOptionsNeverCapture(t *testing.T) {
+	re, err := CompileWithOptions(`(a)(b)`, Options{NeverCapture: true})
+	if errors.Is(err, errors.ErrUnsupported) {
+		t.Skip(err)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := re.NumSubexp(); n != 0 {
+		t.Errorf("NumSubexp() = %d, want 0", n)
+	}
+	if m := re.FindStringSubmatch("ab"); len(m) != 1 || m[0] != "ab" {
+		t.Errorf("FindStringSubmatch() = %q, want [ab]", m)
+	}
+}
+
+func TestOptionsLongest(t *testing.T) {
+	re := MustCompile(`a+?`)
+	if re.Options().Longest {
+		t.Fatal("Options().Longest = true before calling Longest")
+	}
+	re.Longest()
+	if !re.Options().Longest {
+		t.Error("Options().Longest = false after calling Longest")
+	}
+	if got := re.Copy().FindString("aaa"); got != "aaa" {
+		t.Errorf("Copy().FindString() = %q, want %q", got, "aaa")
+	}
+}
+
+func TestCompileCaseInsensitive(t *testing.T) {
+	tests := []struct {
+		pattern string
+		input   string
+		want    bool
+	}{
+		{pattern: `abc`, input: "ABC", want: true},
+		{pattern: `abc`, input: "aBd", want: false},
+		// Flag groups in the expression are still honored.
+		{pattern: `a(?-i:b)c`, input: "AbC", want: true},
+		{pattern: `a(?-i:b)c`, input: "ABC", want: false},
+		{pattern: `(?s:a.c)`, input: "A\nC", want: true},
+	}
+
+	for _, tc := range tests {
+		tt := tc
+		t.Run(tt.pattern+"/"+tt.input, func(t *testing.T) {
+			re := MustCompileCaseInsensitive(tt.pattern)
+			if got := re.MatchString(tt.input); got != tt.want {
+				t.Errorf("MatchString(%q) = %v, want %v", tt.input, got, tt.want)
+			}
+			if !re.Options().CaseInsensitive {
+				t.Error("Options().CaseInsensitive = false, want true")
+			}
+		})
+	}
+}
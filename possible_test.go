@@ -0,0 +1,35 @@
+//go:build re2_cgo
+
+package re2
+
+import (
+	"testing"
+)
+
+func TestPossibleMatchRange(t *testing.T) {
+	tests := []struct {
+		pattern  string
+		maxLen   int
+		min, max string
+		ok       bool
+	}{
+		{pattern: `^abc`, maxLen: 10, min: "abc", max: "abc", ok: true},
+		{pattern: `^a+hello`, maxLen: 10, min: "aa", max: "ahello", ok: true},
+		{pattern: `^a*hello`, maxLen: 10, min: "a", max: "hello", ok: true},
+		{pattern: `^def|abc`, maxLen: 10, min: "abc", max: "def", ok: true},
+		{pattern: `^abcdef`, maxLen: 3, min: "abc", max: "abd", ok: true},
+		{pattern: `^(?i)abc`, maxLen: 10, min: "ABC", max: "abc", ok: true},
+		{pattern: `^[0-9]{3}`, maxLen: 10, min: "000", max: "999", ok: true},
+	}
+
+	for _, tc := range tests {
+		tt := tc
+		t.Run(tt.pattern, func(t *testing.T) {
+			re := MustCompile(tt.pattern)
+			minStr, maxStr, ok := re.PossibleMatchRange(tt.maxLen)
+			if minStr != tt.min || maxStr != tt.max || ok != tt.ok {
+				t.Errorf("PossibleMatchRange(%d) = %q, %q, %v, want %q, %q, %v", tt.maxLen, minStr, maxStr, ok, tt.min, tt.max, tt.ok)
+			}
+		})
+	}
+}
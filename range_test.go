@@ -0,0 +1,60 @@
+package re2
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMatchRange(t *testing.T) {
+	tests := []struct {
+		pattern    string
+		input      string
+		start, end int
+		want       []int
+	}{
+		{pattern: `foo`, input: "foo bar foo", start: 1, end: 11, want: []int{8, 11}},
+		{pattern: `foo`, input: "foo bar foo", start: 1, end: 10, want: nil},
+		{pattern: `bar`, input: "foo bar foo", start: 0, end: 11, want: []int{4, 7}},
+		// Anchors see the full input, not the range.
+		{pattern: `^bar`, input: "foo bar foo", start: 4, end: 7, want: nil},
+		{pattern: `bar$`, input: "foo bar foo", start: 4, end: 7, want: nil},
+		{pattern: `bar$`, input: "foo bar", start: 4, end: 7, want: []int{4, 7}},
+		// Word boundaries see the bytes just outside the range.
+		{pattern: `\bar`, input: "foobar", start: 4, end: 6, want: nil},
+		{pattern: `\bar`, input: "foo ar", start: 4, end: 6, want: []int{4, 6}},
+		{pattern: `a*`, input: "bbb", start: 3, end: 3, want: []int{3, 3}},
+	}
+
+	for _, tc := range tests {
+		tt := tc
+		t.Run(tt.pattern+"/"+tt.input, func(t *testing.T) {
+			re := MustCompile(tt.pattern)
+			if got := re.FindIndexInRange([]byte(tt.input), tt.start, tt.end); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("FindIndexInRange(%q, %d, %d) = %v, want %v", tt.input, tt.start, tt.end, got, tt.want)
+			}
+			if got := re.FindStringIndexInRange(tt.input, tt.start, tt.end); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("FindStringIndexInRange(%q, %d, %d) = %v, want %v", tt.input, tt.start, tt.end, got, tt.want)
+			}
+			if got := re.MatchRange([]byte(tt.input), tt.start, tt.end); got != (tt.want != nil) {
+				t.Errorf("MatchRange(%q, %d, %d) = %v, want %v", tt.input, tt.start, tt.end, got, tt.want != nil)
+			}
+			if got := re.MatchStringRange(tt.input, tt.start, tt.end); got != (tt.want != nil) {
+				t.Errorf("MatchStringRange(%q, %d, %d) = %v, want %v", tt.input, tt.start, tt.end, got, tt.want != nil)
+			}
+		})
+	}
+}
+
+func TestMatchRangeOutOfBounds(t *testing.T) {
+	re := MustCompile(`a`)
+	for _, r := range [][2]int{{-1, 1}, {2, 1}, {0, 4}} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("MatchStringRange(%d, %d) did not panic", r[0], r[1])
+				}
+			}()
+			re.MatchStringRange("abc", r[0], r[1])
+		}()
+	}
+}
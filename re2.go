@@ -1,6 +1,7 @@
 package re2
 
 import (
+	"io"
 	"regexp"
 
 	"github.com/wasilibs/go-re2/internal"
@@ -8,6 +9,69 @@ import (
 
 type Regexp = internal.Regexp
 
+// Options configures compilation of a Regexp, mirroring RE2::Options.
+type Options = internal.CompileOptions
+
+// Error is returned when compiling an invalid regular expression. It unwraps
+// to the equivalent *syntax.Error and also reports where in the expression
+// the error was found.
+type Error = internal.Error
+
+// ProgramSizeError is returned when compiling a regular expression with a
+// program larger than Options.MaxProgramSize.
+type ProgramSizeError = internal.ProgramSizeError
+
+// Input is text prepared for matching by many Regexp without copying it for
+// each match, as is otherwise needed to pass it to re2. It is matched with
+// methods such as Regexp.MatchInput and Regexp.FindAllInputIndex.
+type Input = internal.Input
+
+// NewInput returns an Input holding the text b. b must not be modified while
+// the Input is in use. Release frees the memory held by the Input promptly,
+// otherwise it is freed when the Input is garbage collected.
+func NewInput(b []byte) *Input {
+	return internal.NewInput(b)
+}
+
+// NewInputString returns an Input holding the text s.
+func NewInputString(s string) *Input {
+	return internal.NewInputString(s)
+}
+
+// Anchor restricts where in the input a match may be found.
+type Anchor = internal.Anchor
+
+const (
+	// Unanchored allows a match anywhere in the input, the same as the
+	// methods without an anchor.
+	Unanchored = internal.Unanchored
+	// AnchorStart requires the match to begin at the start of the input.
+	AnchorStart = internal.AnchorStart
+	// AnchorBoth requires the match to span the entire input.
+	AnchorBoth = internal.AnchorBoth
+)
+
+// DefaultReaderWindow is the number of bytes a match found by the Reader
+// and Writer methods of Regexp may span, with twice as many bytes buffered at
+// a time.
+const DefaultReaderWindow = internal.DefaultReaderWindow
+
+// ErrWindowExceeded is returned when a match in the input of a reader may be
+// longer than the window, the maximum number of bytes a match may span.
+var ErrWindowExceeded = internal.ErrWindowExceeded
+
+// MatchReader reports whether the text returned by the RuneReader
+// contains any match of the regular expression pattern.
+// More complicated queries need to use Compile and the full Regexp interface.
+func MatchReader(pattern string, r io.RuneReader) (matched bool, err error) {
+	re, err := Compile(pattern)
+	if err != nil {
+		return false, err
+	}
+	defer internal.Release(re)
+	return re.MatchReader(r), nil
+}
+
 // MatchString reports whether the string s
 // contains any match of the regular expression pattern.
 // More complicated queries need to use Compile and the full Regexp interface.
@@ -69,6 +133,21 @@ func CompilePOSIX(expr string) (*Regexp, error) {
 	return internal.Compile(expr, internal.CompileOptions{Longest: true, Posix: true}) //nolint:wrapcheck // just a method forwarder
 }
 
+// CompileWithOptions is like Compile but allows setting any of the options
+// supported by RE2, for example to treat the expression as a literal or to
+// let . match newlines without rewriting the expression with inline flags.
+// The zero Options is equivalent to Compile.
+func CompileWithOptions(expr string, opts Options) (*Regexp, error) {
+	return internal.Compile(expr, opts) //nolint:wrapcheck // just a method forwarder
+}
+
+// CompileCaseInsensitive is like Compile but matches without regard to
+// case, as if the expression were prefixed with (?i). Flag groups in the
+// expression, including (?-i), still take effect.
+func CompileCaseInsensitive(expr string) (*Regexp, error) {
+	return internal.Compile(expr, internal.CompileOptions{CaseInsensitive: true}) //nolint:wrapcheck // just a method forwarder
+}
+
 // MustCompile is like Compile but panics if the expression cannot be parsed.
 // It simplifies safe initialization of global variables holding compiled regular
 // expressions.
@@ -91,6 +170,17 @@ func MustCompilePOSIX(str string) *Regexp {
 	return regexp
 }
 
+// MustCompileCaseInsensitive is like CompileCaseInsensitive but panics if the expression cannot be parsed.
+// It simplifies safe initialization of global variables holding compiled regular
+// expressions.
+func MustCompileCaseInsensitive(str string) *Regexp {
+	regexp, err := CompileCaseInsensitive(str)
+	if err != nil {
+		panic(`regexp: CompileCaseInsensitive(` + internal.QuoteForError(str) + `): ` + err.Error())
+	}
+	return regexp
+}
+
 // QuoteMeta returns a string that escapes all regular expression metacharacters
 // inside the argument text; the returned string is a regular expression matching
 // the literal text.
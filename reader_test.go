@@ -0,0 +1,157 @@
+package re2
+
+import (
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// runeReader hides the io.Reader implementation of the wrapped reader so
+// the input is read a rune at a time.
+type runeReader struct {
+	r io.RuneReader
+}
+
+func (r runeReader) ReadRune() (rune, int, error) {
+	return r.r.ReadRune()
+}
+
+func TestFindReaderIndexWindow(t *testing.T) {
+	long := strings.Repeat("x", 100)
+	tests := []struct {
+		pattern string
+		input   string
+		want    []int
+		err     error
+	}{
+		{pattern: `abc`, input: long + "abc" + long, want: []int{100, 103}},
+		{pattern: `abc`, input: long + long, want: nil},
+		{pattern: `(a)(b)?`, input: long + "ab", want: []int{100, 102}},
+		// Anchors and word boundaries see the input around the window.
+		{pattern: `^x`, input: long, want: []int{0, 1}},
+		{pattern: `^y`, input: long + "y", want: nil},
+		{pattern: `y$`, input: long + "y" + long, want: nil},
+		{pattern: `y$`, input: long + long + "y", want: []int{200, 201}},
+		{pattern: `\by`, input: long + "y", want: nil},
+		{pattern: `\by`, input: long + " y", want: []int{101, 102}},
+		{pattern: `\d+`, input: long + "12345678" + long, want: []int{100, 108}},
+		// The match may continue past the buffered input.
+		{pattern: `x+`, input: long, err: ErrWindowExceeded},
+		{pattern: `x+`, input: "x" + long[:20], want: []int{0, 21}},
+	}
+
+	for _, tc := range tests {
+		tt := tc
+		t.Run(tt.pattern, func(t *testing.T) {
+			re := MustCompile(tt.pattern)
+			readers := map[string]func() io.RuneReader{
+				"Reader":     func() io.RuneReader { return strings.NewReader(tt.input) },
+				"RuneReader": func() io.RuneReader { return runeReader{strings.NewReader(tt.input)} },
+			}
+			for name, r := range readers {
+				got, err := re.FindReaderIndexWindow(r(), 16)
+				if !errors.Is(err, tt.err) {
+					t.Errorf("%s: FindReaderIndexWindow() error = %v, want %v", name, err, tt.err)
+				}
+				if !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("%s: FindReaderIndexWindow() = %v, want %v", name, got, tt.want)
+				}
+				matched, err := re.MatchReaderWindow(r(), 16)
+				if err != nil {
+					t.Errorf("%s: MatchReaderWindow() error = %v", name, err)
+				}
+				if want := tt.want != nil || tt.err != nil; matched != want {
+					t.Errorf("%s: MatchReaderWindow() = %v, want %v", name, matched, want)
+				}
+			}
+		})
+	}
+}
+
+func TestFindReaderSubmatchIndexWindow(t *testing.T) {
+	re := MustCompile(`(a+)(b)?`)
+	input := strings.Repeat("x", 100) + "aab"
+	got, err := re.FindReaderSubmatchIndexWindow(strings.NewReader(input), 16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []int{100, 103, 100, 102, 102, 103}; !reflect.DeepEqual(got, want) {
+		t.Errorf("FindReaderSubmatchIndexWindow() = %v, want %v", got, want)
+	}
+}
+
+type errReader struct{}
+
+func (errReader) ReadRune() (rune, int, error) {
+	return 0, 0, errors.New("boom")
+}
+
+func TestFindReaderIndexWindowReadError(t *testing.T) {
+	re := MustCompile(`a*`)
+	got, err := re.FindReaderIndexWindow(errReader{}, 16)
+	if err == nil {
+		t.Error("FindReaderIndexWindow() returned no error")
+	}
+	if want := []int{0, 0}; !reflect.DeepEqual(got, want) {
+		t.Errorf("FindReaderIndexWindow() = %v, want %v", got, want)
+	}
+}
+
+func TestReaderWindowLongMatch(t *testing.T) {
+	as := strings.Repeat("a", 40)
+	tests := []struct {
+		pattern   string
+		input     string
+		want      []int
+		err       error
+		matched   bool
+		matchErr  error
+		unbounded []int
+	}{
+		// The leftmost match is longer than the window, and a later one fits.
+		{pattern: `a{40}b|c`, input: as + "bc", err: ErrWindowExceeded, matched: true, unbounded: []int{0, 41}},
+		{pattern: `a{40}b`, input: as + "b", err: ErrWindowExceeded, matchErr: ErrWindowExceeded, unbounded: []int{0, 41}},
+		{pattern: `(?:ab)+c|b`, input: strings.Repeat("ab", 20) + "c", err: ErrWindowExceeded, matched: true, unbounded: []int{0, 41}},
+		// Partial matches which can't be longer than the window.
+		{pattern: `a{10}b|c`, input: as + "c", want: []int{40, 41}, matched: true, unbounded: []int{40, 41}},
+		{pattern: `a{40}b|c`, input: "x" + strings.Repeat("c", 40), want: []int{1, 2}, matched: true, unbounded: []int{1, 2}},
+		{pattern: `\Aa+b`, input: "x" + as + "b", matched: false},
+	}
+
+	for _, tc := range tests {
+		tt := tc
+		t.Run(tt.pattern, func(t *testing.T) {
+			re := MustCompile(tt.pattern)
+			got, err := re.FindReaderIndexWindow(strings.NewReader(tt.input), 16)
+			if !errors.Is(err, tt.err) {
+				t.Errorf("FindReaderIndexWindow() error = %v, want %v", err, tt.err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("FindReaderIndexWindow() = %v, want %v", got, tt.want)
+			}
+			matched, err := re.MatchReaderWindow(strings.NewReader(tt.input), 16)
+			if !errors.Is(err, tt.matchErr) {
+				t.Errorf("MatchReaderWindow() error = %v, want %v", err, tt.matchErr)
+			}
+			if matched != tt.matched {
+				t.Errorf("MatchReaderWindow() = %v, want %v", matched, tt.matched)
+			}
+			if got := re.FindReaderIndex(strings.NewReader(tt.input)); !reflect.DeepEqual(got, tt.unbounded) {
+				t.Errorf("FindReaderIndex() = %v, want %v", got, tt.unbounded)
+			}
+		})
+	}
+}
+
+func TestFindReaderIndexLongMatch(t *testing.T) {
+	// Without a configured window, the input is buffered until the match ends.
+	input := strings.Repeat("a", 3*DefaultReaderWindow)
+	if got, want := MustCompile(`a+`).FindReaderIndex(strings.NewReader(input)), []int{0, len(input)}; !reflect.DeepEqual(got, want) {
+		t.Errorf("FindReaderIndex() = %v, want %v", got, want)
+	}
+	if !MustCompile(`a+b|c`).MatchReader(strings.NewReader(input + "b")) {
+		t.Error("MatchReader() = false, want true")
+	}
+}
@@ -0,0 +1,126 @@
+package re2
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestReplaceNAll(t *testing.T) {
+	// With n < 0, ReplaceN behaves as ReplaceAll.
+	for _, tc := range replaceTests {
+		re := MustCompile(tc.pattern)
+		if got := re.ReplaceStringN(tc.input, tc.replacement, -1); got != tc.output {
+			t.Errorf("%q.ReplaceStringN(%q,%q,-1) = %q; want %q", tc.pattern, tc.input, tc.replacement, got, tc.output)
+		}
+		if got := string(re.ReplaceN([]byte(tc.input), []byte(tc.replacement), -1)); got != tc.output {
+			t.Errorf("%q.ReplaceN(%q,%q,-1) = %q; want %q", tc.pattern, tc.input, tc.replacement, got, tc.output)
+		}
+	}
+}
+
+func TestReplaceN(t *testing.T) {
+	tests := []struct {
+		pattern, replacement, input string
+		n                           int
+		output                      string
+	}{
+		{pattern: `a(x*)b`, replacement: `<$1>`, input: "-ab-axxb-ab-", n: 0, output: "-ab-axxb-ab-"},
+		{pattern: `a(x*)b`, replacement: `<$1>`, input: "-ab-axxb-ab-", n: 1, output: "-<>-axxb-ab-"},
+		{pattern: `a(x*)b`, replacement: `<$1>`, input: "-ab-axxb-ab-", n: 2, output: "-<>-<xx>-ab-"},
+		{pattern: `a(x*)b`, replacement: `<$1>`, input: "-ab-axxb-ab-", n: 5, output: "-<>-<xx>-<>-"},
+		{pattern: `x*`, replacement: `-`, input: "abc", n: 2, output: "-a-bc"},
+	}
+
+	for _, tt := range tests {
+		re := MustCompile(tt.pattern)
+		if got := re.ReplaceStringN(tt.input, tt.replacement, tt.n); got != tt.output {
+			t.Errorf("%q.ReplaceStringN(%q,%q,%d) = %q; want %q", tt.pattern, tt.input, tt.replacement, tt.n, got, tt.output)
+		}
+		if got := string(re.ReplaceN([]byte(tt.input), []byte(tt.replacement), tt.n)); got != tt.output {
+			t.Errorf("%q.ReplaceN(%q,%q,%d) = %q; want %q", tt.pattern, tt.input, tt.replacement, tt.n, got, tt.output)
+		}
+	}
+}
+
+func TestReplaceAllSubmatchFunc(t *testing.T) {
+	// Swap key and value, only for pairs at the start of a line.
+	re := MustCompile(`(?m)^(\w+)=(\w+)`)
+	input := "a=1\nb=2 c=3\n"
+	want := "1=a\n2=b c=3\n"
+
+	got := re.ReplaceAllStringSubmatchFunc(input, func(dst []byte, src string, match []int) []byte {
+		dst = append(dst, src[match[4]:match[5]]...)
+		dst = append(dst, '=')
+		return append(dst, src[match[2]:match[3]]...)
+	})
+	if got != want {
+		t.Errorf("ReplaceAllStringSubmatchFunc() = %q, want %q", got, want)
+	}
+
+	gotBytes := re.ReplaceAllSubmatchFunc([]byte(input), func(dst []byte, src []byte, match []int) []byte {
+		dst = append(dst, src[match[4]:match[5]]...)
+		dst = append(dst, '=')
+		return append(dst, src[match[2]:match[3]]...)
+	})
+	if string(gotBytes) != want {
+		t.Errorf("ReplaceAllSubmatchFunc() = %q, want %q", gotBytes, want)
+	}
+}
+
+func TestReplaceAllSubmatchFuncContext(t *testing.T) {
+	// Rerunning the expression on the matched text alone would see a word
+	// boundary at its start, so the match location must be used.
+	re := MustCompile(`\bfoo`)
+	got := re.ReplaceAllStringSubmatchFunc("foo xfoo foo", func(dst []byte, src string, match []int) []byte {
+		return append(dst, strings.ToUpper(src[match[0]:match[1]])...)
+	})
+	if want := "FOO xfoo FOO"; got != want {
+		t.Errorf("ReplaceAllStringSubmatchFunc() = %q, want %q", got, want)
+	}
+}
+
+func TestReplaceAllTemplate(t *testing.T) {
+	// Templates and replacements exercising the translation to native re2
+	// rewrites, compared against the standard library.
+	tests := []struct {
+		pattern, replacement, input string
+	}{
+		{pattern: `a(x*)b`, replacement: `\1`, input: "-ab-axxb-"},
+		{pattern: `a(x*)b`, replacement: `\\$1\`, input: "-ab-axxb-"},
+		{pattern: `a(x*)b`, replacement: `$$1`, input: "-ab-axxb-"},
+		{pattern: `a(x*)b`, replacement: `$2`, input: "-ab-axxb-"},
+		{pattern: `a(x*)b`, replacement: `${1}1`, input: "-ab-axxb-"},
+		{pattern: `a(x*)b`, replacement: `$`, input: "-ab-axxb-"},
+		{pattern: `a(x*)b`, replacement: `${1`, input: "-ab-axxb-"},
+		{pattern: `a(x*)b`, replacement: `$01`, input: "-ab-axxb-"},
+		{pattern: `a(?P<x>x*)b`, replacement: `[$x]`, input: "-ab-axxb-"},
+		{pattern: `a(?P<x>x*)b`, replacement: `[$y]`, input: "-ab-axxb-"},
+		{pattern: `a(?P<x>x*)(?P<x>b)`, replacement: `[$x]`, input: "-ab-axxb-"},
+		{pattern: `(a)(b)(c)(d)(e)(f)(g)(h)(i)(j)(k)`, replacement: `$11$10$9-$1`, input: "-abcdefghijk-"},
+		{pattern: `(a)(b)(c)(d)(e)(f)(g)(h)(i)(j)(?P<k>k)`, replacement: `$k`, input: "-abcdefghijk-"},
+		{pattern: `x*`, replacement: `[$0]`, input: "☺x☺"},
+		{pattern: `(x)?`, replacement: `[$1]`, input: "axb"},
+		{pattern: `^`, replacement: `\`, input: "abc"},
+		{pattern: `$`, replacement: `\`, input: ""},
+	}
+
+	for _, tt := range tests {
+		re := MustCompile(tt.pattern)
+		want := regexp.MustCompile(tt.pattern).ReplaceAllString(tt.input, tt.replacement)
+		if got := re.ReplaceAllString(tt.input, tt.replacement); got != want {
+			t.Errorf("%q.ReplaceAllString(%q,%q) = %q; want %q", tt.pattern, tt.input, tt.replacement, got, want)
+		}
+		if got := string(re.ReplaceAll([]byte(tt.input), []byte(tt.replacement))); got != want {
+			t.Errorf("%q.ReplaceAll(%q,%q) = %q; want %q", tt.pattern, tt.input, tt.replacement, got, want)
+		}
+
+		want = regexp.MustCompile(tt.pattern).ReplaceAllLiteralString(tt.input, tt.replacement)
+		if got := re.ReplaceAllLiteralString(tt.input, tt.replacement); got != want {
+			t.Errorf("%q.ReplaceAllLiteralString(%q,%q) = %q; want %q", tt.pattern, tt.input, tt.replacement, got, want)
+		}
+		if got := string(re.ReplaceAllLiteral([]byte(tt.input), []byte(tt.replacement))); got != want {
+			t.Errorf("%q.ReplaceAllLiteral(%q,%q) = %q; want %q", tt.pattern, tt.input, tt.replacement, got, want)
+		}
+	}
+}
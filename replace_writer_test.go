@@ -0,0 +1,146 @@
+package re2
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestReplaceAllWriter(t *testing.T) {
+	for _, tc := range replaceTests {
+		re := MustCompile(tc.pattern)
+		var out bytes.Buffer
+		n, err := re.ReplaceAllWriter(&out, strings.NewReader(tc.input), []byte(tc.replacement))
+		if err != nil {
+			t.Errorf("%q.ReplaceAllWriter(%q,%q) error: %v", tc.pattern, tc.input, tc.replacement, err)
+			continue
+		}
+		if got := out.String(); got != tc.output {
+			t.Errorf("%q.ReplaceAllWriter(%q,%q) = %q; want %q", tc.pattern, tc.input, tc.replacement, got, tc.output)
+		}
+		if n != int64(out.Len()) {
+			t.Errorf("%q.ReplaceAllWriter(%q,%q) wrote %d; want %d", tc.pattern, tc.input, tc.replacement, n, out.Len())
+		}
+	}
+}
+
+func TestReplaceAllWriterWindow(t *testing.T) {
+	// Long inputs with small windows, so that matches cross the boundaries of
+	// the buffered input.
+	input := strings.Repeat("abc xyz ☺☺ aaab\n12345 x", 20)
+	tests := []struct {
+		pattern, replacement string
+	}{
+		{pattern: `a+b`, replacement: `<$0>`},
+		{pattern: `x*`, replacement: `-`},
+		{pattern: `☺`, replacement: `:)`},
+		{pattern: `(?m)^\d`, replacement: `#`},
+		{pattern: `(?m)x$`, replacement: `X`},
+		{pattern: `\bx`, replacement: `[$0]`},
+		{pattern: `(\w+) (\w+)`, replacement: `$2 $1`},
+		{pattern: `\d+|\s`, replacement: ``},
+		{pattern: `q`, replacement: `Q`},
+	}
+
+	for _, tt := range tests {
+		re := MustCompile(tt.pattern)
+		want := re.ReplaceAllString(input, tt.replacement)
+		for _, window := range []int{16, 17, 23, 100, 10000} {
+			var out bytes.Buffer
+			if _, err := re.ReplaceAllWriterWindow(&out, iotest.HalfReader(strings.NewReader(input)), []byte(tt.replacement), window); err != nil {
+				t.Errorf("%q.ReplaceAllWriterWindow(%d) error: %v", tt.pattern, window, err)
+				continue
+			}
+			if got := out.String(); got != want {
+				t.Errorf("%q.ReplaceAllWriterWindow(%d) = %q; want %q", tt.pattern, window, got, want)
+			}
+
+			out.Reset()
+			if _, err := re.ReplaceAllLiteralWriterWindow(&out, strings.NewReader(input), []byte(tt.replacement), window); err != nil {
+				t.Errorf("%q.ReplaceAllLiteralWriterWindow(%d) error: %v", tt.pattern, window, err)
+				continue
+			}
+			if got, want := out.String(), re.ReplaceAllLiteralString(input, tt.replacement); got != want {
+				t.Errorf("%q.ReplaceAllLiteralWriterWindow(%d) = %q; want %q", tt.pattern, window, got, want)
+			}
+
+			out.Reset()
+			if _, err := re.ReplaceAllFuncWriterWindow(&out, iotest.OneByteReader(strings.NewReader(input)), bytes.ToUpper, window); err != nil {
+				t.Errorf("%q.ReplaceAllFuncWriterWindow(%d) error: %v", tt.pattern, window, err)
+				continue
+			}
+			if got, want := out.String(), re.ReplaceAllStringFunc(input, strings.ToUpper); got != want {
+				t.Errorf("%q.ReplaceAllFuncWriterWindow(%d) = %q; want %q", tt.pattern, window, got, want)
+			}
+		}
+	}
+}
+
+func TestReplaceAllWriterWindowExceeded(t *testing.T) {
+	tests := []struct {
+		pattern, input, output string
+	}{
+		{pattern: `b+`, input: "ab" + strings.Repeat("b", 100) + "c", output: "a"},
+		// The leftmost match is longer than the window, and a later one fits.
+		{pattern: `a{40}b|c`, input: strings.Repeat("a", 40) + "bc", output: ""},
+		{pattern: `a{40}b|c`, input: "cc" + strings.Repeat("a", 40) + "bc", output: "xx"},
+	}
+
+	for _, tt := range tests {
+		re := MustCompile(tt.pattern)
+		var out bytes.Buffer
+		_, err := re.ReplaceAllWriterWindow(&out, strings.NewReader(tt.input), []byte("x"), 16)
+		if !errors.Is(err, ErrWindowExceeded) {
+			t.Errorf("%q: error = %v; want %v", tt.pattern, err, ErrWindowExceeded)
+		}
+		if got := out.String(); got != tt.output {
+			t.Errorf("%q: output = %q; want %q", tt.pattern, got, tt.output)
+		}
+	}
+
+	// Partial matches which can't be longer than the window are replaced.
+	re := MustCompile(`a{10}b|c`)
+	input := strings.Repeat("a", 40) + "c"
+	var out bytes.Buffer
+	if _, err := re.ReplaceAllWriterWindow(&out, strings.NewReader(input), []byte("x"), 16); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := out.String(), re.ReplaceAllString(input, "x"); got != want {
+		t.Errorf("output = %q; want %q", got, want)
+	}
+}
+
+func TestReplaceAllWriterErrors(t *testing.T) {
+	re := MustCompile(`b`)
+	testErr := errors.New("test error")
+
+	// The output for the input read before the error is written.
+	var out bytes.Buffer
+	_, err := re.ReplaceAllWriterWindow(&out, iotest.TimeoutReader(strings.NewReader(strings.Repeat("abc", 100))), []byte("x"), 16)
+	if !errors.Is(err, iotest.ErrTimeout) {
+		t.Errorf("error = %v; want %v", err, iotest.ErrTimeout)
+	}
+	if want := strings.Repeat("axc", 11); out.String() != want {
+		t.Errorf("output = %q; want %q", out.String(), want)
+	}
+
+	_, err = re.ReplaceAllWriter(&out, iotest.ErrReader(testErr), []byte("x"))
+	if !errors.Is(err, testErr) {
+		t.Errorf("error = %v; want %v", err, testErr)
+	}
+
+	_, err = re.ReplaceAllWriter(errWriter{testErr}, strings.NewReader("abc"), []byte("x"))
+	if !errors.Is(err, testErr) {
+		t.Errorf("error = %v; want %v", err, testErr)
+	}
+}
+
+type errWriter struct {
+	err error
+}
+
+func (w errWriter) Write([]byte) (int, error) {
+	return 0, w.err
+}
@@ -0,0 +1,61 @@
+package re2
+
+import (
+	"testing"
+)
+
+func TestExtract(t *testing.T) {
+	tests := []struct {
+		pattern string
+		text    string
+		rewrite string
+		want    string
+		ok      bool
+	}{
+		{pattern: `(.*)@([^.]*)`, text: "boris@kremvax.ru", rewrite: `\2!\1`, want: "kremvax!boris", ok: true},
+		{pattern: `[a-z]+`, text: "--abc--", rewrite: `<\0>`, want: "<abc>", ok: true},
+		{pattern: `(a)|(b)`, text: "b", rewrite: `[\1][\2]`, want: "[][b]", ok: true},
+		{pattern: `(a)`, text: "a", rewrite: `\\\1\\`, want: `\a\`, ok: true},
+		{pattern: `(a)`, text: "a", rewrite: `$1`, want: "$1", ok: true},
+		{pattern: `(a)`, text: "b", rewrite: `\1`, ok: false},
+		// Invalid rewrites.
+		{pattern: `(a)`, text: "a", rewrite: `\2`, ok: false},
+		{pattern: `(a)`, text: "a", rewrite: `\x`, ok: false},
+		{pattern: `(a)`, text: "a", rewrite: `a\`, ok: false},
+	}
+
+	for _, tc := range tests {
+		tt := tc
+		t.Run(tt.rewrite, func(t *testing.T) {
+			got, ok := MustCompile(tt.pattern).Extract(tt.text, tt.rewrite)
+			if got != tt.want || ok != tt.ok {
+				t.Errorf("Extract(%q, %q) = %q, %v, want %q, %v", tt.text, tt.rewrite, got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestCheckRewrite(t *testing.T) {
+	tests := []struct {
+		pattern string
+		rewrite string
+		valid   bool
+	}{
+		{pattern: `(a)(b)`, rewrite: `\2\1\0`, valid: true},
+		{pattern: `(a)(b)`, rewrite: `no groups \\`, valid: true},
+		{pattern: `(a)(b)`, rewrite: `\3`, valid: false},
+		{pattern: `a`, rewrite: `\1`, valid: false},
+		{pattern: `(a)`, rewrite: `\a`, valid: false},
+		{pattern: `(a)`, rewrite: `\`, valid: false},
+	}
+
+	for _, tc := range tests {
+		tt := tc
+		t.Run(tt.rewrite, func(t *testing.T) {
+			err := MustCompile(tt.pattern).CheckRewrite(tt.rewrite)
+			if (err == nil) != tt.valid {
+				t.Errorf("CheckRewrite(%q) = %v, want valid %v", tt.rewrite, err, tt.valid)
+			}
+		})
+	}
+}
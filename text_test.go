@@ -0,0 +1,140 @@
+package re2
+
+import (
+	"encoding"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"regexp"
+	"testing"
+)
+
+var (
+	_ encoding.TextMarshaler   = (*Regexp)(nil)
+	_ encoding.TextAppender    = (*Regexp)(nil)
+	_ encoding.TextUnmarshaler = (*Regexp)(nil)
+)
+
+func TestMethodSet(t *testing.T) {
+	stdType := reflect.TypeOf((*regexp.Regexp)(nil))
+	re2Type := reflect.TypeOf((*Regexp)(nil))
+
+	// Maps types in the signatures of regexp.Regexp to the equivalent here.
+	convert := func(typ reflect.Type) reflect.Type {
+		if typ == stdType {
+			return re2Type
+		}
+		return typ
+	}
+
+	for i := 0; i < stdType.NumMethod(); i++ {
+		stdMethod := stdType.Method(i)
+		re2Method, ok := re2Type.MethodByName(stdMethod.Name)
+		if !ok {
+			t.Errorf("missing method %s", stdMethod.Name)
+			continue
+		}
+		stdFunc, re2Func := stdMethod.Type, re2Method.Type
+		ok = stdFunc.NumIn() == re2Func.NumIn() && stdFunc.NumOut() == re2Func.NumOut() && stdFunc.IsVariadic() == re2Func.IsVariadic()
+		for j := 0; ok && j < stdFunc.NumIn(); j++ {
+			ok = convert(stdFunc.In(j)) == re2Func.In(j)
+		}
+		for j := 0; ok && j < stdFunc.NumOut(); j++ {
+			ok = convert(stdFunc.Out(j)) == re2Func.Out(j)
+		}
+		if !ok {
+			t.Errorf("method %s has signature %v, want %v", stdMethod.Name, re2Func, stdFunc)
+		}
+	}
+}
+
+func TestMarshalText(t *testing.T) {
+	type config struct {
+		Pattern  *Regexp
+		Patterns []*Regexp
+	}
+
+	in := config{
+		Pattern:  MustCompile(`a+b`),
+		Patterns: []*Regexp{MustCompile(`(?i)hello`), MustCompile(`[0-9]{3}`)},
+	}
+	data, err := json.Marshal(&in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"Pattern":"a+b","Patterns":["(?i)hello","[0-9]{3}"]}`; string(data) != want {
+		t.Errorf("json.Marshal = %s, want %s", data, want)
+	}
+
+	var out config
+	if err := json.Unmarshal(data, &out); err != nil {
+		t.Fatal(err)
+	}
+	if got := out.Pattern.FindString("xaab"); got != "aab" {
+		t.Errorf("FindString = %q, want %q", got, "aab")
+	}
+	if got := out.Patterns[0].MatchString("HELLO"); !got {
+		t.Errorf("MatchString = %v, want true", got)
+	}
+	if got := out.Patterns[1].String(); got != `[0-9]{3}` {
+		t.Errorf("String = %q, want %q", got, `[0-9]{3}`)
+	}
+
+	// A Regexp field that is not a pointer is filled in place.
+	var value struct {
+		Pattern Regexp
+	}
+	if err := json.Unmarshal([]byte(`{"Pattern":"b+"}`), &value); err != nil {
+		t.Fatal(err)
+	}
+	if got := value.Pattern.FindString("abbc"); got != "bb" {
+		t.Errorf("FindString = %q, want %q", got, "bb")
+	}
+
+	// Unmarshaling replaces an existing expression.
+	if err := value.Pattern.UnmarshalText([]byte(`c+`)); err != nil {
+		t.Fatal(err)
+	}
+	if got := value.Pattern.FindString("abccd"); got != "cc" {
+		t.Errorf("FindString = %q, want %q", got, "cc")
+	}
+
+	if err := out.Pattern.UnmarshalText([]byte(`a(`)); err == nil {
+		t.Error("expected error unmarshaling invalid expression")
+	}
+
+	if got, _ := MustCompile(`x*`).AppendText([]byte("re:")); string(got) != "re:x*" {
+		t.Errorf("AppendText = %q, want %q", got, "re:x*")
+	}
+}
+
+func TestLiteralPrefixOptions(t *testing.T) {
+	tests := []struct {
+		pattern  string
+		opts     Options
+		prefix   string
+		complete bool
+	}{
+		{pattern: `abc+`, opts: Options{}, prefix: "abc", complete: false},
+		{pattern: `abc+`, opts: Options{CaseInsensitive: true}, prefix: "", complete: false},
+		{pattern: `a.c`, opts: Options{Literal: true}, prefix: "a.c", complete: true},
+		{pattern: `ab\C`, opts: Options{}, prefix: "", complete: false},
+	}
+
+	for _, tc := range tests {
+		tt := tc
+		t.Run(tt.pattern, func(t *testing.T) {
+			re, err := CompileWithOptions(tt.pattern, tt.opts)
+			if errors.Is(err, errors.ErrUnsupported) {
+				t.Skip(err)
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			prefix, complete := re.LiteralPrefix()
+			if prefix != tt.prefix || complete != tt.complete {
+				t.Errorf("LiteralPrefix() = %q, %v, want %q, %v", prefix, complete, tt.prefix, tt.complete)
+			}
+		})
+	}
+}